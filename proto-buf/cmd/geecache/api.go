@@ -0,0 +1,247 @@
+package main
+
+import (
+	"Cache/proto-buf/geecache"
+	"Cache/proto-buf/geecache/consistenthash"
+	"Cache/proto-buf/geecache/rest"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const maxValueBytes = 64 << 20 // PUT 请求中 value 的最大长度
+
+// PeerStatus 是 /admin/peers 返回的单个节点
+type PeerStatus struct {
+	Addr    string `json:"addr"`
+	Self    bool   `json:"self,omitempty"`
+	Ejected bool   `json:"ejected,omitempty"` // 健康检查失败，已从哈希环中移除
+}
+
+// PeersResponse 是 /admin/peers 的响应
+type PeersResponse struct {
+	Self      string       `json:"self"`
+	Transport string       `json:"transport"`
+	Peers     []PeerStatus `json:"peers"`
+}
+
+// RingNode 是哈希环上的一个节点及其负责的哈希空间比例
+type RingNode struct {
+	Addr  string  `json:"addr"`
+	Share float64 `json:"share"`
+}
+
+// RingResponse 是 /admin/ring 的响应，请求带有 key 时给出负责它的节点
+type RingResponse struct {
+	Nodes []RingNode `json:"nodes"`
+	Key   string     `json:"key,omitempty"`
+	Owner string     `json:"owner,omitempty"`
+}
+
+// StatsResponse 是 /admin/stats 的响应
+type StatsResponse struct {
+	Self   string                `json:"self"`
+	Groups []geecache.GroupStats `json:"groups"`
+}
+
+// DumpResponse 是 /admin/dump 的响应
+type DumpResponse struct {
+	Group string   `json:"group"`
+	Keys  []string `json:"keys"`
+}
+
+// clientAuth 按 apiTokens 和 acl 返回客户端的认证方式和访问控制，API、RESP 和 memcached 协议共用。
+// 没有配置 apiTokens 时返回的 auth 为 nil，不做认证
+func (s *server) clientAuth() (geecache.Authenticator, *geecache.ACL) {
+	if len(s.cfg.APITokens) == 0 {
+		return nil, nil
+	}
+	var acl *geecache.ACL
+	if len(s.cfg.ACL) > 0 {
+		acl = geecache.NewACL()
+		for group, principals := range s.cfg.ACL {
+			acl.Allow(group, principals...)
+		}
+	}
+	return geecache.TokenAuth(s.cfg.APITokens), acl
+}
+
+// apiHandler 返回 API 服务的路由：
+//
+//	GET|PUT|DELETE /api?group=<group>&key=<key>  读取、写入和删除 key，group 默认为第一个 group，PUT 可以带 ttl=30s
+//	GET /admin/stats                             各个 group 的统计信息
+//	GET /admin/peers                             节点列表及其健康状况
+//	GET /admin/ring?key=<key>                    哈希环上各节点的比例，以及负责 key 的节点
+//	GET /admin/dump?group=<group>&limit=<n>      当前节点缓存中的 key
+//	/v1/...                                      REST API，见 rest 包
+//
+// 配置了 apiTokens 时所有请求都需要认证，/admin 下与具体 group 无关的接口要求调用方在 acl 中拥有 "*" 的权限
+func (s *server) apiHandler() http.Handler {
+	auth, acl := s.clientAuth()
+	// authorized 认证请求并检查调用方能否访问 group，失败时写入错误
+	authorized := func(w http.ResponseWriter, r *http.Request, group string) bool {
+		if _, err := geecache.Authorize(auth, acl, r, group); err != nil {
+			http.Error(w, err.Error(), geecache.HTTPStatus(err))
+			return false
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", rest.NewHandler(rest.Config{Auth: auth, ACL: acl}))
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("group")
+		if name == "" {
+			name = s.groups[0].Name()
+		}
+		if !authorized(w, r, name) {
+			return
+		}
+		g := geecache.GetGroup(name)
+		if g == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		s.serveKey(w, r, g, r.URL.Query().Get("key"))
+	})
+	mux.HandleFunc("/admin/stats", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r, "*") {
+			return
+		}
+		res := StatsResponse{Self: s.cfg.Self}
+		for _, g := range s.groups {
+			res.Groups = append(res.Groups, g.Stats())
+		}
+		writeJSON(w, res)
+	})
+	mux.HandleFunc("/admin/peers", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r, "*") {
+			return
+		}
+		writeJSON(w, s.peers())
+	})
+	mux.HandleFunc("/admin/ring", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(w, r, "*") {
+			return
+		}
+		writeJSON(w, s.ring(r.URL.Query().Get("key")))
+	})
+	mux.HandleFunc("/admin/dump", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("group")
+		if name == "" {
+			// 不能用空的 group 检查权限，否则有 "*" 权限的调用方会得到 404 而不是参数错误
+			http.Error(w, "group is required", http.StatusBadRequest)
+			return
+		}
+		if !authorized(w, r, name) {
+			return
+		}
+		g := geecache.GetGroup(name)
+		if g == nil {
+			http.Error(w, "no such group: "+name, http.StatusNotFound)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		keys := g.Keys(limit)
+		if keys == nil {
+			keys = []string{}
+		}
+		writeJSON(w, DumpResponse{Group: name, Keys: keys})
+	})
+	return mux
+}
+
+// serveKey 处理对单个 key 的读取、写入和删除。写入和删除只影响当前节点的缓存
+func (s *server) serveKey(w http.ResponseWriter, r *http.Request, g *geecache.Group, key string) {
+	switch r.Method {
+	case http.MethodGet:
+		view, err := g.Get(key)
+		if err != nil {
+			http.Error(w, err.Error(), geecache.HTTPStatus(err))
+			return
+		}
+		b, err := view.Bytes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(b)
+	case http.MethodPut:
+		var ttl time.Duration
+		if v := r.URL.Query().Get("ttl"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				http.Error(w, fmt.Sprintf("invalid ttl %q", v), http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxValueBytes+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxValueBytes {
+			http.Error(w, "value too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := g.Set(key, body, ttl); err != nil {
+			http.Error(w, err.Error(), geecache.HTTPStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !g.Remove(key) {
+			http.Error(w, key+" is not cached", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// peers 返回配置的节点列表，HTTP 节点池还会给出被弹出的节点
+func (s *server) peers() PeersResponse {
+	ejected := map[string]bool{}
+	if p, ok := s.picker.(interface{ Ejected() []string }); ok {
+		for _, addr := range p.Ejected() {
+			ejected[addr] = true
+		}
+	}
+	res := PeersResponse{Self: s.cfg.Self, Transport: s.cfg.Transport}
+	for _, addr := range s.cfg.Peers {
+		res.Peers = append(res.Peers, PeerStatus{Addr: addr, Self: addr == s.cfg.Self, Ejected: ejected[addr]})
+	}
+	return res
+}
+
+// ring 返回哈希环上各节点的比例，key 不为空时给出负责它的节点
+func (s *server) ring(key string) RingResponse {
+	res := RingResponse{Nodes: []RingNode{}, Key: key}
+	p, ok := s.picker.(interface{ Ring() *consistenthash.Map })
+	if !ok || p.Ring() == nil {
+		return res
+	}
+	ring := p.Ring()
+	for addr, share := range ring.Shares() {
+		res.Nodes = append(res.Nodes, RingNode{Addr: addr, Share: share})
+	}
+	sort.Slice(res.Nodes, func(i, j int) bool { return res.Nodes[i].Addr < res.Nodes[j].Addr })
+	if key != "" {
+		res.Owner = ring.Get(key)
+	}
+	return res
+}
+
+// writeJSON 以 JSON 格式写入响应
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
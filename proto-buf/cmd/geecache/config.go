@@ -0,0 +1,174 @@
+package main
+
+import (
+	"Cache/proto-buf/geecache"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	defaultHandoff         = 1000
+	defaultShutdownTimeout = 10 * time.Second
+)
+
+// Config 是缓存服务器的配置文件，例如 geecache.example.json
+type Config struct {
+	Self        string   `json:"self"`                  // 其他节点访问当前节点的地址，http 时为 URL，grpc 和 tcp 时为 host:port
+	Listen      string   `json:"listen,omitempty"`      // 节点间通信的监听地址，默认取 self 中的 host:port
+	Transport   string   `json:"transport,omitempty"`   // 节点间的通信方式：http（默认）、grpc 或 tcp
+	Peers       []string `json:"peers"`                 // 集群中的全部节点，包括当前节点
+	PeerTimeout Duration `json:"peerTimeout,omitempty"` // 单次请求其他节点的超时时间
+	PeerKey     string   `json:"peerKey,omitempty"`     // 节点之间签名请求的共享密钥
+
+	API       string              `json:"api,omitempty"`       // API 服务的监听地址，为空时不启动
+	APITokens map[string]string   `json:"apiTokens,omitempty"` // API、RESP 和 memcached 协议接受的 token 及其身份，为空时不做认证
+	ACL       map[string][]string `json:"acl,omitempty"`       // 各 group 允许访问的身份，为空时不限制
+	RESP      string              `json:"resp,omitempty"`      // Redis 协议的监听地址，为空时不启动
+	Memcache  string              `json:"memcache,omitempty"`  // memcached 协议的监听地址，为空时不启动
+
+	Handoff         int      `json:"handoff,omitempty"`         // 下线时每个 group 推送给新负责节点的热点条目数，只用于 http 且需要配置 peerKey
+	ShutdownTimeout Duration `json:"shutdownTimeout,omitempty"` // 等待正在处理的请求完成的时间
+
+	Groups []GroupConfig `json:"groups"`
+}
+
+// GroupConfig 是一个 group 的配置
+type GroupConfig struct {
+	Name        string       `json:"name"`
+	CacheBytes  int64        `json:"cacheBytes"`            // 缓存的最大字节数
+	TTL         Duration     `json:"ttl,omitempty"`         // value 的有效期，为 0 时不过期
+	NegativeTTL Duration     `json:"negativeTTL,omitempty"` // 不存在的 key 的缓存时间，为 0 时不缓存
+	HotKeyQPS   float64      `json:"hotKeyQPS,omitempty"`   // 热点 key 在请求方本地缓存的 QPS 阈值，为 0 时不缓存
+	Codec       string       `json:"codec,omitempty"`       // 缓存中 value 的压缩格式，目前只支持 gzip
+	Getter      GetterConfig `json:"getter"`                // 未命中时加载数据的数据源
+}
+
+// Duration 是以 "1m30s" 这样的字符串表示的时间间隔
+type Duration time.Duration
+
+// UnmarshalJSON 解析 time.ParseDuration 格式的字符串
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON 实现了 json.Marshaler 接口
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig 读取并校验配置文件
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields() // 拼错的字段名应该直接报错，而不是被悄悄忽略
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// validate 校验配置并填充默认值，命令行参数覆盖配置文件之后调用
+func (c *Config) validate() error {
+	if c.Transport == "" {
+		c.Transport = "http"
+	}
+	if c.Self == "" {
+		return fmt.Errorf("config: self is required")
+	}
+	switch c.Transport {
+	case "http":
+		u, err := url.Parse(c.Self)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("config: self must be a URL for the http transport, got %q", c.Self)
+		}
+		if c.Listen == "" {
+			c.Listen = u.Host
+		}
+	case "grpc", "tcp":
+		if _, _, err := net.SplitHostPort(c.Self); err != nil {
+			return fmt.Errorf("config: self must be host:port for the %s transport, got %q", c.Transport, c.Self)
+		}
+		if c.Listen == "" {
+			c.Listen = c.Self
+		}
+	default:
+		return fmt.Errorf("config: unknown transport %q", c.Transport)
+	}
+	if len(c.Peers) == 0 {
+		c.Peers = []string{c.Self} // 单节点运行
+	}
+	if c.Handoff == 0 {
+		c.Handoff = defaultHandoff
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = Duration(defaultShutdownTimeout)
+	}
+
+	if len(c.Groups) == 0 {
+		return fmt.Errorf("config: at least one group is required")
+	}
+	seen := make(map[string]bool, len(c.Groups))
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("config: group name is required")
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("config: duplicate group %s", g.Name)
+		}
+		seen[g.Name] = true
+		if g.CacheBytes <= 0 {
+			return fmt.Errorf("config: group %s: cacheBytes must be positive", g.Name)
+		}
+		if g.Codec != "" && g.Codec != "gzip" {
+			return fmt.Errorf("config: group %s: unknown codec %q", g.Name, g.Codec)
+		}
+		if err := g.Getter.validate(); err != nil {
+			return fmt.Errorf("config: group %s: %v", g.Name, err)
+		}
+	}
+	for _, principal := range c.APITokens {
+		if principal == geecache.PeerPrincipal {
+			return fmt.Errorf("config: apiTokens: principal %s is reserved for peers", principal)
+		}
+	}
+	for group := range c.ACL {
+		if group != "*" && !seen[group] {
+			return fmt.Errorf("config: acl refers to unknown group %s", group)
+		}
+	}
+	return nil
+}
+
+// newGroup 按配置创建并注册 group
+func (g GroupConfig) newGroup() (*geecache.Group, error) {
+	getter, err := g.Getter.build()
+	if err != nil {
+		return nil, err
+	}
+	group := geecache.NewGroup(g.Name, g.CacheBytes, getter)
+	group.SetTTL(time.Duration(g.TTL))
+	group.SetNegativeTTL(time.Duration(g.NegativeTTL))
+	group.SetHotKeyQPS(g.HotKeyQPS)
+	if g.Codec == "gzip" {
+		group.SetCodec(geecache.GzipCodec{})
+	}
+	return group, nil
+}
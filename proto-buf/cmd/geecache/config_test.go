@@ -0,0 +1,145 @@
+package main
+
+import (
+	"Cache/proto-buf/geecache"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig("geecache.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatalf("example config is invalid: %v", err)
+	}
+	if cfg.Listen != "localhost:8001" || time.Duration(cfg.Groups[0].TTL) != 10*time.Minute {
+		t.Errorf("unexpected config: listen %q, ttl %v", cfg.Listen, time.Duration(cfg.Groups[0].TTL))
+	}
+
+	for _, tt := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{Self: "localhost:8001"}, "self must be a URL"},
+		{Config{Self: "http://localhost:8001", Transport: "tcp"}, "self must be host:port"},
+		{Config{Self: "http://localhost:8001"}, "at least one group"},
+		{Config{Self: "http://localhost:8001", Groups: []GroupConfig{{Name: "g", CacheBytes: 1, Getter: GetterConfig{Type: "redis"}}}}, "unknown getter type"},
+		{Config{Self: "http://localhost:8001", Groups: []GroupConfig{{Name: "g", CacheBytes: 1, Getter: GetterConfig{Type: "http", URL: "http://db"}}}}, "must contain {key}"},
+		{Config{Self: "http://localhost:8001", Groups: []GroupConfig{{Name: "g", CacheBytes: 1, Getter: GetterConfig{Type: "static"}}}, ACL: map[string][]string{"other": {"alice"}}}, "unknown group other"},
+		{Config{Self: "http://localhost:8001", Groups: []GroupConfig{{Name: "g", CacheBytes: 1, Getter: GetterConfig{Type: "static"}}}, APITokens: map[string]string{"t": geecache.PeerPrincipal}}, "reserved for peers"},
+	} {
+		if err := tt.cfg.validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("validate() = %v, want an error containing %q", err, tt.want)
+		}
+	}
+}
+
+// freeAddr 返回一个当前空闲的回环地址
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+func TestServer(t *testing.T) {
+	cfg := &Config{
+		Self:      freeAddr(t),
+		Transport: "tcp",
+		API:       freeAddr(t),
+		Groups: []GroupConfig{{
+			Name:       "cmd-scores",
+			CacheBytes: 1 << 10,
+			Getter:     GetterConfig{Type: "static", Data: map[string]string{"Tom": "630"}},
+		}},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{cfg: cfg, errc: make(chan error, 8)}
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path string) (int, string) {
+		var res *http.Response
+		var err error
+		// API 服务在后台启动，稍等它开始监听
+		for i := 0; i < 50; i++ {
+			req, _ := http.NewRequest(method, "http://"+cfg.API+path, strings.NewReader("567"))
+			if res, err = http.DefaultClient.Do(req); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b)
+	}
+	if code, body := do("GET", "/api?key=Tom"); code != http.StatusOK || body != "630" {
+		t.Errorf("GET Tom = %d %q", code, body)
+	}
+	if code, _ := do("GET", "/api?group=cmd-scores&key=kkk"); code != http.StatusNotFound {
+		t.Errorf("GET kkk = %d, want 404", code)
+	}
+	if code, body := do("GET", "/v1/groups/cmd-scores/keys/Tom"); code != http.StatusOK || body != "630" {
+		t.Errorf("GET /v1 Tom = %d %q", code, body)
+	}
+	if code, _ := do("PUT", "/api?key=Sam&ttl=1m"); code != http.StatusNoContent {
+		t.Errorf("PUT Sam = %d, want 204", code)
+	}
+	if code, body := do("GET", "/api?key=Sam"); code != http.StatusOK || body != "567" {
+		t.Errorf("GET Sam = %d %q", code, body)
+	}
+
+	var stats StatsResponse
+	if code, body := do("GET", "/admin/stats"); code != http.StatusOK || json.Unmarshal([]byte(body), &stats) != nil {
+		t.Fatalf("GET /admin/stats = %d %q", code, body)
+	}
+	if len(stats.Groups) != 1 || stats.Groups[0].Items != 2 || stats.Groups[0].LocalLoads != 2 {
+		t.Errorf("stats = %+v", stats.Groups)
+	}
+	var dump DumpResponse
+	if _, body := do("GET", "/admin/dump?group=cmd-scores&limit=1"); json.Unmarshal([]byte(body), &dump) != nil ||
+		!reflect.DeepEqual(dump.Keys, []string{"Sam"}) {
+		t.Errorf("GET /admin/dump = %q", body)
+	}
+	if code, _ := do("GET", "/admin/dump"); code != http.StatusBadRequest {
+		t.Errorf("GET /admin/dump without group = %d, want 400", code)
+	}
+	var ring RingResponse
+	if _, body := do("GET", "/admin/ring?key=Tom"); json.Unmarshal([]byte(body), &ring) != nil ||
+		len(ring.Nodes) != 1 || ring.Nodes[0].Share != 1 || ring.Owner != cfg.Self {
+		t.Errorf("GET /admin/ring = %q", body)
+	}
+	if code, _ := do("DELETE", "/api?key=Sam"); code != http.StatusNoContent {
+		t.Errorf("DELETE Sam = %d, want 204", code)
+	}
+	if code, _ := do("DELETE", "/api?key=Sam"); code != http.StatusNotFound {
+		t.Errorf("second DELETE Sam = %d, want 404", code)
+	}
+
+	s.shutdown()
+	select {
+	case err := <-s.errc:
+		t.Errorf("listener failed: %v", err)
+	default:
+	}
+	if _, err := http.Get("http://" + cfg.API + "/api?key=Tom"); err == nil {
+		t.Errorf("api server still running after shutdown")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"Cache/proto-buf/geecache"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultGetterTimeout = 5 * time.Second
+	maxGetterResponse    = 64 << 20 // http 数据源单个 value 的最大长度
+)
+
+// GetterConfig 描述 group 的数据源，Type 决定使用哪些字段：
+//
+//	{"type": "static", "data": {"Tom": "630"}}                     配置文件中的固定数据
+//	{"type": "file", "path": "scores.json"}                         JSON 对象文件，每次加载时重新读取
+//	{"type": "http", "url": "http://db.internal/scores/{key}"}      GET 请求，404 表示 key 不存在
+type GetterConfig struct {
+	Type    string            `json:"type"`
+	Data    map[string]string `json:"data,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Timeout Duration          `json:"timeout,omitempty"` // http 数据源单次请求的超时时间
+}
+
+// validate 校验数据源的配置
+func (c GetterConfig) validate() error {
+	switch c.Type {
+	case "static":
+	case "file":
+		if c.Path == "" {
+			return fmt.Errorf("file getter: path is required")
+		}
+	case "http":
+		if !strings.Contains(c.URL, "{key}") {
+			return fmt.Errorf("http getter: url must contain {key}, got %q", c.URL)
+		}
+	default:
+		return fmt.Errorf("unknown getter type %q", c.Type)
+	}
+	return nil
+}
+
+// build 创建数据源
+func (c GetterConfig) build() (geecache.Getter, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	switch c.Type {
+	case "static":
+		return mapGetter(c.Data), nil
+	case "file":
+		return fileGetter(c.Path), nil
+	}
+	timeout := time.Duration(c.Timeout)
+	if timeout <= 0 {
+		timeout = defaultGetterTimeout
+	}
+	return &httpGetter{url: c.URL, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// notFound 返回 key 不存在的错误
+func notFound(key string) error {
+	return fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound)
+}
+
+// mapGetter 从固定的数据中加载
+type mapGetter map[string]string
+
+// Get 实现了 geecache.Getter 接口
+func (m mapGetter) Get(key string) ([]byte, error) {
+	if v, ok := m[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, notFound(key)
+}
+
+// fileGetter 从 JSON 对象文件中加载，每次加载都重新读取文件，修改文件后不需要重启
+type fileGetter string
+
+// Get 实现了 geecache.Getter 接口
+func (f fileGetter) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", string(f), err)
+	}
+	return mapGetter(m).Get(key)
+}
+
+// httpGetter 通过 HTTP GET 从其他服务加载，响应体就是 value
+type httpGetter struct {
+	url    string // 包含 {key} 的 URL 模板
+	client *http.Client
+}
+
+// Get 实现了 geecache.Getter 接口
+func (h *httpGetter) Get(key string) ([]byte, error) {
+	res, err := h.client.Get(strings.ReplaceAll(h.url, "{key}", url.PathEscape(key)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", geecache.ErrUnavailable, err)
+	}
+	defer res.Body.Close()
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, notFound(key)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: backend returned %s", geecache.ErrUnavailable, res.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxGetterResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading backend response: %v", geecache.ErrUnavailable, err)
+	}
+	if len(b) > maxGetterResponse {
+		return nil, fmt.Errorf("value of %s exceeds %d bytes", key, maxGetterResponse)
+	}
+	return b, nil
+}
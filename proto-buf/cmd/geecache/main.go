@@ -0,0 +1,268 @@
+package main
+
+/*
+geecache 是可以直接部署的缓存服务器，节点、group 和数据源都来自配置文件，
+命令行参数可以覆盖其中的部分字段：
+
+$ go run ./proto-buf/cmd/geecache -config proto-buf/cmd/geecache/geecache.example.json
+$ go run ./proto-buf/cmd/geecache -config geecache.example.json -self http://localhost:8002 -api -
+$ curl "http://localhost:9999/api?group=scores&key=Tom"
+630
+
+收到 SIGINT 或 SIGTERM 后，HTTP 节点先把热点数据移交给其他节点，
+然后停止接受新请求，等待正在处理的请求完成后退出。
+*/
+
+import (
+	"Cache/proto-buf/geecache"
+	"Cache/proto-buf/geecache/memcache"
+	"Cache/proto-buf/geecache/resp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// server 管理缓存服务器的各个监听器，按启动的相反顺序关闭
+type server struct {
+	cfg    *Config
+	groups []*geecache.Group
+	errc   chan error                  // 监听器意外退出的错误
+	picker geecache.PeerPicker         // 节点池，提供哈希环和节点的健康状况
+	drain  func(ctx context.Context)   // 下线前移交热点数据，为 nil 时跳过
+	stops  []func(ctx context.Context) // 关闭各个监听器
+}
+
+// serve 在后台运行监听器，意外退出时报告错误
+func (s *server) serve(name string, run func() error) {
+	go func() {
+		if err := run(); err != nil && !isClosed(err) {
+			s.errc <- fmt.Errorf("%s: %v", name, err)
+		}
+	}()
+}
+
+// isClosed 判断监听器是否因为正常关闭而退出
+func isClosed(err error) bool {
+	return errors.Is(err, http.ErrServerClosed) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, grpc.ErrServerStopped) || errors.Is(err, resp.ErrServerClosed) ||
+		errors.Is(err, memcache.ErrServerClosed)
+}
+
+// start 创建 group 并启动所有监听器
+func (s *server) start() error {
+	for _, gc := range s.cfg.Groups {
+		g, err := gc.newGroup()
+		if err != nil {
+			return fmt.Errorf("group %s: %v", gc.Name, err)
+		}
+		s.groups = append(s.groups, g)
+	}
+	if err := s.startPeers(); err != nil {
+		return err
+	}
+	if s.cfg.API != "" {
+		api := &http.Server{Addr: s.cfg.API, Handler: s.apiHandler()}
+		s.serve("api", api.ListenAndServe)
+		s.stops = append(s.stops, func(ctx context.Context) { api.Shutdown(ctx) })
+		log.Println("api server is running at", s.cfg.API)
+	}
+	// 不带 group 前缀的 key 属于第一个 group
+	auth, acl := s.clientAuth()
+	if s.cfg.RESP != "" {
+		rs := resp.NewServer(resp.Config{DefaultGroup: s.groups[0].Name(), Auth: auth, ACL: acl})
+		s.serve("resp", func() error { return rs.ListenAndServe(s.cfg.RESP) })
+		s.stops = append(s.stops, func(context.Context) { rs.Close() })
+		log.Println("redis protocol server is running at", s.cfg.RESP)
+	}
+	if s.cfg.Memcache != "" {
+		ms := memcache.NewServer(memcache.Config{DefaultGroup: s.groups[0].Name(), Auth: auth, ACL: acl})
+		s.serve("memcache", func() error { return ms.ListenAndServe(s.cfg.Memcache) })
+		s.stops = append(s.stops, func(context.Context) { ms.Close() })
+		log.Println("memcached protocol server is running at", s.cfg.Memcache)
+	}
+	return nil
+}
+
+// startPeers 按配置的通信方式创建节点池并启动节点间通信的监听器
+func (s *server) startPeers() error {
+	timeout := time.Duration(s.cfg.PeerTimeout)
+	lis, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return err
+	}
+	var peerAuth *geecache.HMACAuth
+	if s.cfg.PeerKey != "" {
+		peerAuth = geecache.NewHMACAuth([]byte(s.cfg.PeerKey))
+	}
+	var picker geecache.PeerPicker
+	switch s.cfg.Transport {
+	case "http":
+		var opts []geecache.HTTPPoolOption
+		if timeout > 0 {
+			opts = append(opts, geecache.WithTimeout(timeout))
+		}
+		if peerAuth != nil {
+			opts = append(opts, geecache.WithAuth(peerAuth, nil), geecache.WithSigner(peerAuth))
+		}
+		pool := geecache.NewHTTPPool(s.cfg.Self, opts...)
+		pool.Set(s.cfg.Peers...)
+		stopHealth := pool.StartHealthCheck(5 * time.Second)
+		srv := &http.Server{Handler: pool}
+		s.serve("peers", func() error { return srv.Serve(lis) })
+		// 其他节点只接受签名的推送，没有配置 peerKey 时跳过移交
+		if peerAuth != nil {
+			s.drain = func(ctx context.Context) {
+				n, err := pool.Drain(ctx, s.cfg.Handoff)
+				log.Printf("handed off %d entries (err: %v)", n, err)
+			}
+		} else if s.cfg.Handoff > 0 {
+			log.Println("handoff requires peerKey, hot entries will not be handed off on shutdown")
+		}
+		s.stops = append(s.stops, func(ctx context.Context) {
+			stopHealth()
+			srv.Shutdown(ctx)
+		})
+		picker = pool
+	case "grpc":
+		pool := geecache.NewGRPCPool(s.cfg.Self)
+		if timeout > 0 {
+			pool.SetTimeout(timeout)
+		}
+		if peerAuth != nil {
+			pool.SetAuth(peerAuth, nil)
+			pool.SetSigner(peerAuth)
+		}
+		if err := pool.Set(s.cfg.Peers...); err != nil {
+			lis.Close()
+			return err
+		}
+		srv := grpc.NewServer(pool.ServerOptions()...)
+		pool.Register(srv)
+		s.serve("peers", func() error { return srv.Serve(lis) })
+		s.stops = append(s.stops, func(ctx context.Context) {
+			gracefulStop(ctx, srv)
+			pool.Close()
+		})
+		picker = pool
+	case "tcp":
+		pool := geecache.NewTCPPool(s.cfg.Self)
+		if timeout > 0 {
+			pool.SetTimeout(timeout)
+		}
+		if peerAuth != nil {
+			pool.SetAuth(peerAuth, nil)
+			pool.SetSigner(peerAuth)
+		}
+		pool.Set(s.cfg.Peers...)
+		s.serve("peers", func() error { return pool.Serve(lis) })
+		s.stops = append(s.stops, func(context.Context) {
+			lis.Close()
+			pool.Close()
+		})
+		picker = pool
+	}
+	for _, g := range s.groups {
+		g.RegisterPeers(picker)
+	}
+	s.picker = picker
+	log.Printf("geecache is running at %s over %s, listening on %s", s.cfg.Self, s.cfg.Transport, s.cfg.Listen)
+	return nil
+}
+
+// gracefulStop 等待正在处理的 RPC 完成，超过 ctx 的截止时间后强制关闭
+func gracefulStop(ctx context.Context, srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// shutdown 移交热点数据后按启动的相反顺序关闭监听器，移交和关闭共用 ShutdownTimeout
+func (s *server) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.cfg.ShutdownTimeout))
+	defer cancel()
+	if s.drain != nil {
+		s.drain(ctx)
+	}
+	for i := len(s.stops) - 1; i >= 0; i-- {
+		s.stops[i](ctx)
+	}
+}
+
+func main() {
+	var configPath, self, listen, transport, api, peers string
+	flag.StringVar(&configPath, "config", "", "Path of the JSON config file")
+	flag.StringVar(&self, "self", "", "Overrides self in the config file")
+	flag.StringVar(&listen, "listen", "", "Overrides listen in the config file")
+	flag.StringVar(&transport, "transport", "", "Overrides transport in the config file: http, grpc or tcp")
+	flag.StringVar(&api, "api", "", "Overrides api in the config file, \"-\" disables the API server")
+	flag.StringVar(&peers, "peers", "", "Comma separated peers, overrides peers in the config file")
+	flag.Parse()
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "geecache: -config is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 同一份配置文件可以用于集群中的所有节点，只需要覆盖各自的地址
+	if self != "" {
+		cfg.Self, cfg.Listen = self, ""
+	}
+	if listen != "" {
+		cfg.Listen = listen
+	}
+	if transport != "" {
+		cfg.Transport = transport
+	}
+	if api == "-" {
+		cfg.API = ""
+	} else if api != "" {
+		cfg.API = api
+	}
+	if peers != "" {
+		cfg.Peers = strings.Split(peers, ",")
+	}
+	if err := cfg.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{cfg: cfg, errc: make(chan error, 8)}
+	if err := s.start(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := 0
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case v := <-sig:
+		log.Println("received", v, "shutting down")
+	case err := <-s.errc:
+		log.Println(err, "shutting down")
+		code = 1
+	}
+	s.shutdown()
+	log.Println("geecache stopped")
+	os.Exit(code)
+}
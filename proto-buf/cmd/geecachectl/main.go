@@ -0,0 +1,360 @@
+package main
+
+/*
+geecachectl 通过 API 服务操作运行中的 geecache 集群：
+
+$ geecachectl get scores Tom
+630
+$ geecachectl set -ttl 10m scores Sam 567
+$ echo -n 567 | geecachectl set scores Sam -
+$ geecachectl del scores Sam
+$ geecachectl stats
+GROUP   GETS  HITS  PEER LOADS  LOCAL LOADS  ITEMS  BYTES  CACHE BYTES
+scores  3     1     1           1            2      12     2048
+$ geecachectl ring Tom
+NODE                   SHARE
+http://localhost:8001  31.62%
+http://localhost:8002  35.07%
+http://localhost:8003  33.31%
+Tom -> http://localhost:8002
+$ geecachectl peers
+PEER                   STATE
+http://localhost:8001  up (self)
+http://localhost:8002  up
+http://localhost:8003  ejected
+transport: http
+$ geecachectl dump -limit 10 scores
+
+-addr 指定 API 服务的地址，默认为 http://localhost:9999；
+API 服务要求认证时用 -token 或环境变量 GEECACHE_TOKEN 提供 token。
+set 和 del 只影响 -addr 所在节点的缓存，key 不归该节点负责时会在标准错误输出警告
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// client 向 API 服务发送请求
+type client struct {
+	addr   string // API 服务的地址，例如 "http://localhost:9999"
+	token  string // 不为空时以 Bearer token 认证
+	http   *http.Client
+	stderr io.Writer // 输出警告
+}
+
+// do 发送请求并返回响应体，非 2xx 的响应转换为错误
+func (c *client) do(method, path string, query url.Values, body io.Reader) ([]byte, error) {
+	u := strings.TrimSuffix(c.addr, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+// getJSON 发送 GET 请求并把 JSON 响应解码到 v
+func (c *client) getJSON(path string, query url.Values, v any) error {
+	b, err := c.do(http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// command 是一个子命令，参数不包括子命令的名称
+type command struct {
+	usage string
+	run   func(c *client, out io.Writer, args []string) error
+}
+
+var commands = map[string]command{
+	"get":   {"get <group> <key>", runGet},
+	"set":   {"set [-ttl 30s] <group> <key> <value|->", runSet},
+	"del":   {"del <group> <key>", runDel},
+	"stats": {"stats", runStats},
+	"peers": {"peers", runPeers},
+	"ring":  {"ring [key]", runRing},
+	"dump":  {"dump [-limit n] <group>", runDump},
+}
+
+// errUsage 表示参数不正确，调用方打印子命令的用法
+var errUsage = fmt.Errorf("invalid arguments")
+
+func keyQuery(group, key string) url.Values {
+	return url.Values{"group": {group}, "key": {key}}
+}
+
+// runGet 输出 key 的 value
+func runGet(c *client, out io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	b, err := c.do(http.MethodGet, "/api", keyQuery(args[0], args[1]), nil)
+	if err != nil {
+		return err
+	}
+	out.Write(b)
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+// runSet 写入 key，value 为 "-" 时从标准输入读取
+func runSet(c *client, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	ttl := fs.Duration("ttl", 0, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 3 {
+		return errUsage
+	}
+	var body io.Reader = strings.NewReader(fs.Arg(2))
+	if fs.Arg(2) == "-" {
+		body = os.Stdin
+	}
+	q := keyQuery(fs.Arg(0), fs.Arg(1))
+	if *ttl > 0 {
+		q.Set("ttl", ttl.String())
+	}
+	warnNotOwner(c, fs.Arg(1))
+	_, err := c.do(http.MethodPut, "/api", q, body)
+	return err
+}
+
+// runDel 从节点的缓存中删除 key
+func runDel(c *client, out io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	warnNotOwner(c, args[1])
+	_, err := c.do(http.MethodDelete, "/api", keyQuery(args[0], args[1]), nil)
+	return err
+}
+
+// owner 返回哈希环上负责 key 的节点和 API 服务所在的节点
+func (c *client) owner(key string) (owner, self string, err error) {
+	var ring struct {
+		Owner string `json:"owner"`
+	}
+	if err := c.getJSON("/admin/ring", url.Values{"key": {key}}, &ring); err != nil {
+		return "", "", err
+	}
+	var peers struct {
+		Self string `json:"self"`
+	}
+	if err := c.getJSON("/admin/peers", nil, &peers); err != nil {
+		return "", "", err
+	}
+	return ring.Owner, peers.Self, nil
+}
+
+// warnNotOwner 在 API 服务所在的节点不负责 key 时提醒用户：写入和删除只影响该节点的缓存，
+// 其他节点读取 key 时仍然从负责的节点获取。无法确定负责的节点时不提醒
+func warnNotOwner(c *client, key string) {
+	owner, self, err := c.owner(key)
+	if err != nil || owner == "" || owner == self {
+		return
+	}
+	fmt.Fprintf(c.stderr, "geecachectl: warning: %s is owned by %s, not %s; "+
+		"the change only affects the cache of %s, use -addr with the API server of the owner\n",
+		key, owner, self, c.addr)
+}
+
+// runStats 输出各个 group 的统计信息
+func runStats(c *client, out io.Writer, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	var res struct {
+		Groups []struct {
+			Name       string `json:"name"`
+			Gets       int64  `json:"gets"`
+			Hits       int64  `json:"hits"`
+			PeerLoads  int64  `json:"peerLoads"`
+			LocalLoads int64  `json:"localLoads"`
+			Items      int    `json:"items"`
+			Bytes      int64  `json:"bytes"`
+			CacheBytes int64  `json:"cacheBytes"`
+		} `json:"groups"`
+	}
+	if err := c.getJSON("/admin/stats", nil, &res); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tGETS\tHITS\tPEER LOADS\tLOCAL LOADS\tITEMS\tBYTES\tCACHE BYTES")
+	for _, g := range res.Groups {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			g.Name, g.Gets, g.Hits, g.PeerLoads, g.LocalLoads, g.Items, g.Bytes, g.CacheBytes)
+	}
+	return tw.Flush()
+}
+
+// runPeers 输出节点列表及其健康状况
+func runPeers(c *client, out io.Writer, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	var res struct {
+		Transport string `json:"transport"`
+		Peers     []struct {
+			Addr    string `json:"addr"`
+			Self    bool   `json:"self"`
+			Ejected bool   `json:"ejected"`
+		} `json:"peers"`
+	}
+	if err := c.getJSON("/admin/peers", nil, &res); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tSTATE")
+	for _, p := range res.Peers {
+		state := "up"
+		if p.Ejected {
+			state = "ejected"
+		}
+		if p.Self {
+			state += " (self)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", p.Addr, state)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "transport: %s\n", res.Transport)
+	return err
+}
+
+// runRing 输出哈希环上各节点负责的比例，带 key 时给出负责它的节点
+func runRing(c *client, out io.Writer, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	q := url.Values{}
+	if len(args) == 1 {
+		q.Set("key", args[0])
+	}
+	var res struct {
+		Nodes []struct {
+			Addr  string  `json:"addr"`
+			Share float64 `json:"share"`
+		} `json:"nodes"`
+		Key   string `json:"key"`
+		Owner string `json:"owner"`
+	}
+	if err := c.getJSON("/admin/ring", q, &res); err != nil {
+		return err
+	}
+	sort.Slice(res.Nodes, func(i, j int) bool { return res.Nodes[i].Addr < res.Nodes[j].Addr })
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tSHARE")
+	for _, n := range res.Nodes {
+		fmt.Fprintf(tw, "%s\t%.2f%%\n", n.Addr, n.Share*100)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if res.Key != "" {
+		fmt.Fprintf(out, "%s -> %s\n", res.Key, res.Owner)
+	}
+	return nil
+}
+
+// runDump 输出节点缓存中的 key，按最近访问的顺序排列
+func runDump(c *client, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	limit := fs.Int("limit", 0, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	q := url.Values{"group": {fs.Arg(0)}}
+	if *limit > 0 {
+		q.Set("limit", fmt.Sprint(*limit))
+	}
+	var res struct {
+		Keys []string `json:"keys"`
+	}
+	if err := c.getJSON("/admin/dump", q, &res); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	for _, key := range res.Keys {
+		b.WriteString(key + "\n")
+	}
+	_, err := out.Write(b.Bytes())
+	return err
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: geecachectl [flags] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	c := &client{stderr: os.Stderr}
+	var timeout time.Duration
+	flag.StringVar(&c.addr, "addr", "http://localhost:9999", "Address of the API server")
+	flag.StringVar(&c.token, "token", os.Getenv("GEECACHE_TOKEN"), "Bearer token for the API server, defaults to $GEECACHE_TOKEN")
+	flag.DurationVar(&timeout, "timeout", 10*time.Second, "Timeout of a single request")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "geecachectl: unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	c.http = &http.Client{Timeout: timeout}
+
+	if err := cmd.run(c, os.Stdout, flag.Args()[1:]); err != nil {
+		if err == errUsage {
+			fmt.Fprintln(os.Stderr, "usage: geecachectl "+cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "geecachectl:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAPI 模拟 API 服务，当前节点为 http://self，以 remote 开头的 key 归 http://other 负责
+func fakeAPI(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	store := map[string]string{"scores/Tom": "630"}
+	writeJSON := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		id := q.Get("group") + "/" + q.Get("key")
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			v, ok := store[id]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			io.WriteString(w, v)
+		case http.MethodPut:
+			if q.Get("ttl") != "" && q.Get("ttl") != "10m0s" {
+				http.Error(w, "unexpected ttl "+q.Get("ttl"), http.StatusBadRequest)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			store[id] = string(b)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			delete(store, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("/admin/ring", func(w http.ResponseWriter, r *http.Request) {
+		res := map[string]any{"nodes": []map[string]any{
+			{"addr": "http://self", "share": 0.25},
+			{"addr": "http://other", "share": 0.75},
+		}}
+		if key := r.URL.Query().Get("key"); key != "" {
+			res["key"], res["owner"] = key, "http://self"
+			if strings.HasPrefix(key, "remote") {
+				res["owner"] = "http://other"
+			}
+		}
+		writeJSON(w, res)
+	})
+	mux.HandleFunc("/admin/peers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"self": "http://self"})
+	})
+	mux.HandleFunc("/admin/dump", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("group") != "scores" || r.URL.Query().Get("limit") != "2" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{"group": "scores", "keys": []string{"Tom", "Sam"}})
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t1" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCommands(t *testing.T) {
+	server := fakeAPI(t)
+	var stderr bytes.Buffer
+	c := &client{addr: server.URL, token: "t1", http: server.Client(), stderr: &stderr}
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := commands[args[0]].run(c, &out, args[1:])
+		return out.String(), err
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"get", "scores", "Tom"}, "630\n"},
+		{[]string{"set", "-ttl", "10m", "scores", "Sam", "567"}, ""},
+		{[]string{"get", "scores", "Sam"}, "567\n"},
+		{[]string{"del", "scores", "Sam"}, ""},
+		{[]string{"ring", "Tom"}, "NODE          SHARE\nhttp://other  75.00%\nhttp://self   25.00%\nTom -> http://self\n"},
+		{[]string{"dump", "-limit", "2", "scores"}, "Tom\nSam\n"},
+	} {
+		if got, err := run(tt.args...); err != nil || got != tt.want {
+			t.Errorf("%v = %q, %v, want %q", tt.args, got, err, tt.want)
+		}
+	}
+	if _, err := run("get", "scores", "Sam"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("get of a deleted key error = %v, want 404", err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("unexpected warning for keys owned by the API server: %q", stderr.String())
+	}
+
+	// key 不归 API 服务所在的节点负责时提醒用户
+	for _, args := range [][]string{{"set", "scores", "remote-1", "1"}, {"del", "scores", "remote-1"}} {
+		stderr.Reset()
+		if _, err := run(args...); err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+		if !strings.Contains(stderr.String(), "remote-1 is owned by http://other, not http://self") {
+			t.Errorf("%v warning = %q", args, stderr.String())
+		}
+	}
+
+	for _, args := range [][]string{{"get", "scores"}, {"set", "scores", "Sam"}, {"dump"}, {"ring", "a", "b"}} {
+		if _, err := run(args...); err != errUsage {
+			t.Errorf("%v error = %v, want errUsage", args, err)
+		}
+	}
+	c.token = "wrong"
+	if _, err := run("get", "scores", "Tom"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("get with a wrong token error = %v, want 401", err)
+	}
+}
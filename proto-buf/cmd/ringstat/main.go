@@ -0,0 +1,179 @@
+package main
+
+/*
+$ go run ./proto-buf/cmd/ringstat -replicas 10 -keys 20000
+replicas=10 hash=crc32 keys=20000
+  node                               keys    share
+  http://localhost:8001              7461   37.30%
+  http://localhost:8002              6593   32.97%
+  http://localhost:8003              5946   29.73%
+  stddev 620.7 keys (9.31% of mean)
+  add    http://new-node                remapped  20.16% (ideal 25.00%)
+  remove http://localhost:8001          remapped  37.30% (ideal 33.33%)
+  remove http://localhost:8002          remapped  32.97% (ideal 33.33%)
+  remove http://localhost:8003          remapped  29.73% (ideal 33.33%)
+*/
+
+import (
+	"Cache/proto-buf/geecache/consistenthash"
+	"flag"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"hash/fnv"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hashes 是可供选择的哈希函数
+var hashes = map[string]consistenthash.Hash{
+	"crc32": crc32.ChecksumIEEE,
+	"fnv1a": func(data []byte) uint32 {
+		h := fnv.New32a()
+		h.Write(data)
+		return h.Sum32()
+	},
+	"adler32": adler32.Checksum,
+}
+
+// buildRing 用给定的节点、虚拟节点数和哈希函数构建哈希环
+func buildRing(nodes []string, replicas int, fn consistenthash.Hash) *consistenthash.Map {
+	m := consistenthash.New(replicas, fn)
+	m.Add(nodes...)
+	return m
+}
+
+// assign 计算每个样本 key 所属的节点
+func assign(m *consistenthash.Map, keys []string) []string {
+	owners := make([]string, len(keys))
+	for i, key := range keys {
+		owners[i] = m.Get(key)
+	}
+	return owners
+}
+
+// remapped 返回两次分配结果中归属发生变化的 key 的比例
+func remapped(before, after []string) float64 {
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+// without 返回去掉 node 之后的节点列表
+func without(nodes []string, node string) []string {
+	rest := make([]string, 0, len(nodes)-1)
+	for _, n := range nodes {
+		if n != node {
+			rest = append(rest, n)
+		}
+	}
+	return rest
+}
+
+// report 输出某个虚拟节点数下的分布情况
+func report(nodes []string, replicas int, hashName, added string, keys []string) {
+	fn := hashes[hashName]
+	owners := assign(buildRing(nodes, replicas, fn), keys)
+
+	counts := make(map[string]int, len(nodes))
+	for _, owner := range owners {
+		counts[owner]++
+	}
+
+	fmt.Printf("replicas=%d hash=%s keys=%d\n", replicas, hashName, len(keys))
+	fmt.Printf("  %-30s %8s %8s\n", "node", "keys", "share")
+	mean := float64(len(keys)) / float64(len(nodes))
+	var variance float64
+	for _, node := range nodes {
+		c := counts[node]
+		variance += (float64(c) - mean) * (float64(c) - mean)
+		fmt.Printf("  %-30s %8d %7.2f%%\n", node, c, 100*float64(c)/float64(len(keys)))
+	}
+	stddev := math.Sqrt(variance / float64(len(nodes)))
+	fmt.Printf("  stddev %.1f keys (%.2f%% of mean)\n", stddev, 100*stddev/mean)
+
+	// 增加一个节点后理想的迁移比例为 1/(n+1)
+	grown := assign(buildRing(append(append([]string{}, nodes...), added), replicas, fn), keys)
+	fmt.Printf("  add    %-30s remapped %6.2f%% (ideal %.2f%%)\n",
+		added, 100*remapped(owners, grown), 100/float64(len(nodes)+1))
+
+	// 移除一个节点后只有它的 key 需要迁移，理想情况下每个节点负责 1/n
+	if len(nodes) > 1 {
+		for _, node := range nodes {
+			shrunk := assign(buildRing(without(nodes, node), replicas, fn), keys)
+			fmt.Printf("  remove %-30s remapped %6.2f%% (ideal %.2f%%)\n",
+				node, 100*remapped(owners, shrunk), 100/float64(len(nodes)))
+		}
+	}
+	fmt.Println()
+}
+
+func main() {
+	var (
+		nodeList    string
+		replicaList string
+		hashName    string
+		added       string
+		numKeys     int
+	)
+	flag.StringVar(&nodeList, "nodes", "http://localhost:8001,http://localhost:8002,http://localhost:8003", "Comma separated node addresses")
+	flag.StringVar(&replicaList, "replicas", "50", "Comma separated virtual node counts to compare")
+	flag.StringVar(&hashName, "hash", "crc32", "Hash function: crc32, fnv1a or adler32")
+	flag.StringVar(&added, "add", "http://new-node", "Node address used to measure remapping on add")
+	flag.IntVar(&numKeys, "keys", 100000, "Number of sample keys")
+	flag.Parse()
+
+	var nodes []string
+	seen := make(map[string]bool)
+	for _, node := range strings.Split(nodeList, ",") {
+		node = strings.TrimSpace(node)
+		if node == "" {
+			continue
+		}
+		if seen[node] {
+			log.Fatalf("duplicate node: %s", node)
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		log.Fatal("at least one node is required")
+	}
+	added = strings.TrimSpace(added)
+	if added == "" || seen[added] {
+		log.Fatalf("-add must be a node that is not in -nodes: %q", added)
+	}
+	if _, ok := hashes[hashName]; !ok {
+		log.Fatalf("unknown hash function: %s", hashName)
+	}
+	if numKeys <= 0 {
+		log.Fatal("keys must be positive")
+	}
+
+	var replicas []int
+	for _, s := range strings.Split(replicaList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid replicas: %q", s)
+		}
+		replicas = append(replicas, n)
+	}
+	sort.Ints(replicas)
+
+	// 样本 key 与线上 key 的形态无关，只需足够多且足够分散
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = "key-" + strconv.Itoa(i)
+	}
+
+	for _, r := range replicas {
+		report(nodes, r, hashName, added, keys)
+	}
+}
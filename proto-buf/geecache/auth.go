@@ -0,0 +1,236 @@
+package geecache
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PeerPrincipal 是通过节点间签名校验的调用方身份，
+	// 节点属于集群本身，可以访问所有 group，不受 ACL 限制
+	PeerPrincipal = "geecache-peer"
+
+	timestampHeader   = "X-Geecache-Timestamp"
+	signatureHeader   = "X-Geecache-Signature"
+	defaultMaxSkew    = 5 * time.Minute // 签名时间戳允许的最大偏差，超过视为重放
+	bearerTokenPrefix = "Bearer "
+)
+
+var (
+	// ErrUnauthenticated 表示请求没有携带有效的凭证
+	ErrUnauthenticated = errors.New("geecache: unauthenticated")
+	// ErrForbidden 表示调用方无权访问该 group
+	ErrForbidden = errors.New("geecache: forbidden")
+)
+
+// Authenticator 校验请求携带的凭证，返回调用方的身份
+type Authenticator interface {
+	Authenticate(r *http.Request) (principal string, err error)
+}
+
+// Signer 为发往其他节点的请求附加凭证
+type Signer interface {
+	Sign(r *http.Request) error
+}
+
+// HMACAuth 使用节点间共享的密钥对请求签名和校验签名
+type HMACAuth struct {
+	key     []byte
+	maxSkew time.Duration
+}
+
+// NewHMACAuth 使用共享密钥创建 HMACAuth
+func NewHMACAuth(key []byte) *HMACAuth {
+	return &HMACAuth{key: key, maxSkew: defaultMaxSkew}
+}
+
+// Sign 在请求头中加入时间戳和签名，签名覆盖方法、路径、查询参数、时间戳和请求体
+func (a *HMACAuth) Sign(r *http.Request) error {
+	body, err := peekBody(r)
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(timestampHeader, ts)
+	r.Header.Set(signatureHeader, a.signature(r, ts, body))
+	return nil
+}
+
+// Authenticate 校验请求的签名和时间戳
+func (a *HMACAuth) Authenticate(r *http.Request) (string, error) {
+	ts := r.Header.Get(timestampHeader)
+	sig := r.Header.Get(signatureHeader)
+	if ts == "" || sig == "" {
+		return "", ErrUnauthenticated
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", ErrUnauthenticated
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return "", ErrUnauthenticated
+	}
+	body, err := peekBody(r)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(sig), []byte(a.signature(r, ts, body))) {
+		return "", ErrUnauthenticated
+	}
+	return PeerPrincipal, nil
+}
+
+// signature 计算请求的签名
+func (a *HMACAuth) signature(r *http.Request, ts string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		ts,
+		hex.EncodeToString(sum[:]),
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// peekBody 读出请求体用于签名，并把请求体恢复原样
+func peekBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// rpcRequest 把 gRPC 或 TCP 协议中的一次调用表示为 HTTP 请求，header 作为请求头，
+// 这样 HTTPPool 使用的 Authenticator 和 Signer 可以直接用于其他通信方式
+func rpcRequest(path string, header map[string][]string) *http.Request {
+	r := &http.Request{Method: http.MethodPost, URL: &url.URL{Path: path}, Header: make(http.Header)}
+	for k, vs := range header {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	return r
+}
+
+// TokenAuth 校验 "Authorization: Bearer <token>" 请求头，按 token 查找调用方身份。
+// 身份为 PeerPrincipal 的 token 会被忽略，节点身份只能通过节点间的签名获得
+type TokenAuth map[string]string
+
+// Authenticate 实现了 Authenticator 接口
+func (a TokenAuth) Authenticate(r *http.Request) (string, error) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, bearerTokenPrefix) {
+		return "", ErrUnauthenticated
+	}
+	token := strings.TrimPrefix(h, bearerTokenPrefix)
+	for t, principal := range a {
+		// 逐个做常数时间比较，避免通过响应时间猜测 token
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 && principal != PeerPrincipal {
+			return principal, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// MultiAuth 依次尝试多个 Authenticator，返回第一个校验成功的身份
+type MultiAuth []Authenticator
+
+// Authenticate 实现了 Authenticator 接口
+func (m MultiAuth) Authenticate(r *http.Request) (string, error) {
+	for _, a := range m {
+		if principal, err := a.Authenticate(r); err == nil {
+			return principal, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// ACL 按 group 控制允许访问的身份。group 为 "*" 的规则适用于没有单独规则的 group，
+// 身份为 "*" 表示允许所有通过认证的调用方
+type ACL struct {
+	mu    sync.RWMutex
+	rules map[string]map[string]bool // group -> 允许的身份
+}
+
+// NewACL 创建一个拒绝所有访问的 ACL
+func NewACL() *ACL {
+	return &ACL{rules: make(map[string]map[string]bool)}
+}
+
+// Allow 允许 principals 访问 group
+func (a *ACL) Allow(group string, principals ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rules[group] == nil {
+		a.rules[group] = make(map[string]bool)
+	}
+	for _, p := range principals {
+		a.rules[group][p] = true
+	}
+}
+
+// Allowed 判断 principal 是否可以访问 group
+func (a *ACL) Allowed(group, principal string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	rule, ok := a.rules[group]
+	if !ok {
+		rule = a.rules["*"]
+	}
+	return rule[principal] || rule["*"]
+}
+
+// Authorize 认证请求并检查调用方能否访问 group。
+// auth 为 nil 时不做认证；acl 为 nil 时所有通过认证的调用方都可以访问。
+// 返回 ErrUnauthenticated 或 ErrForbidden，调用方据此返回 401 或 403
+func Authorize(auth Authenticator, acl *ACL, r *http.Request, group string) (principal string, err error) {
+	if auth == nil {
+		return "", nil
+	}
+	if principal, err = auth.Authenticate(r); err != nil {
+		return "", ErrUnauthenticated
+	}
+	if !permitted(acl, group, principal) {
+		return principal, ErrForbidden
+	}
+	return principal, nil
+}
+
+// permitted 判断已经通过认证的 principal 能否访问 group，acl 为 nil 时不限制，节点不受 ACL 限制
+func permitted(acl *ACL, group, principal string) bool {
+	return acl == nil || principal == PeerPrincipal || acl.Allowed(group, principal)
+}
+
+// WithAuth 要求访问节点的请求通过 auth 认证，并按 acl 检查 group 的访问权限
+func WithAuth(auth Authenticator, acl *ACL) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.auth = auth
+		p.acl = acl
+	}
+}
+
+// WithSigner 为发往其他节点的请求签名，通常与其他节点的 WithAuth 配合使用
+func WithSigner(s Signer) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.signer = s
+	}
+}
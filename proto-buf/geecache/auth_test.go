@@ -0,0 +1,90 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHMACAuth(t *testing.T) {
+	a := NewHMACAuth([]byte("secret"))
+	req := httptest.NewRequest(http.MethodPut, "/_geecache/scores/Tom", strings.NewReader("630"))
+	if err := a.Sign(req); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if principal, err := a.Authenticate(req); err != nil || principal != PeerPrincipal {
+		t.Fatalf("Authenticate = %q, %v", principal, err)
+	}
+
+	// 修改请求体或使用不同的密钥都会导致校验失败
+	tampered := httptest.NewRequest(http.MethodPut, "/_geecache/scores/Tom", strings.NewReader("999"))
+	tampered.Header = req.Header
+	if _, err := a.Authenticate(tampered); err != ErrUnauthenticated {
+		t.Fatalf("tampered body should be rejected, got %v", err)
+	}
+	if _, err := NewHMACAuth([]byte("other")).Authenticate(req); err != ErrUnauthenticated {
+		t.Fatalf("wrong key should be rejected, got %v", err)
+	}
+}
+
+func TestHTTPPoolAuth(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	})
+	NewGroup("auth-alice", 2<<10, getter)
+	NewGroup("auth-bob", 2<<10, getter)
+
+	peerAuth := NewHMACAuth([]byte("cluster-key"))
+	acl := NewACL()
+	acl.Allow("auth-alice", "alice")
+	acl.Allow("auth-bob", "bob")
+	auth := MultiAuth{peerAuth, TokenAuth{"alice-token": "alice", "bob-token": "bob"}}
+	server := httptest.NewServer(NewHTTPPool("http://remote", WithAuth(auth, acl)))
+	defer server.Close()
+
+	get := func(path, token string) int {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+defaultBasePath+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	tests := []struct {
+		path, token string
+		want        int
+	}{
+		{"auth-alice/Tom", "", http.StatusUnauthorized},
+		{"auth-alice/Tom", "wrong", http.StatusUnauthorized},
+		{"auth-alice/Tom", "alice-token", http.StatusOK},
+		{"auth-bob/Tom", "alice-token", http.StatusForbidden},
+		{"auth-bob/Tom", "bob-token", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := get(tt.path, tt.token); got != tt.want {
+			t.Errorf("GET %s with token %q = %d, want %d", tt.path, tt.token, got, tt.want)
+		}
+	}
+
+	// 节点之间使用签名访问，不受 ACL 限制
+	p := NewHTTPPool("http://self", WithSigner(peerAuth))
+	p.Set(server.URL)
+	peer, _ := p.PickPeer("Tom")
+	for _, group := range []string{"auth-alice", "auth-bob"} {
+		if err := peer.Get(&pb.Request{Group: group, Key: "Tom"}, &pb.Response{}); err != nil {
+			t.Errorf("signed Get from %s failed: %v", group, err)
+		}
+	}
+	unsigned := NewHTTPPool("http://self")
+	unsigned.Set(server.URL)
+	peer, _ = unsigned.PickPeer("Tom")
+	if err := peer.Get(&pb.Request{Group: "auth-alice", Key: "Tom"}, &pb.Response{}); err == nil {
+		t.Errorf("unsigned Get should be rejected")
+	}
+}
@@ -0,0 +1,289 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// BatchGetter 是 Getter 可选实现的接口，用于一次加载多个 key。
+// GetMulti 用它一次加载所有需要在本地加载的 key，并发的 Get 在合并窗口内
+// 未命中的 key 也会合并为一次调用（见 SetBatchWindow）。
+// 返回的 map 中没有的 key 视为不存在，返回错误时所有 key 都以该错误失败
+type BatchGetter interface {
+	GetMulti(keys []string) (map[string][]byte, error)
+}
+
+// Result 是 GetMulti 中单个 key 的结果
+type Result struct {
+	Value ByteView
+	Err   error
+}
+
+// GetMulti 获取多个 key 的值。未命中缓存的 key 按负责的节点分组，
+// 每个节点只发送一次批量请求，需要在本地加载的 key 由 BatchGetter 合并加载。
+// 返回值按 key 索引，每个 key 都有各自的结果或错误
+func (g *Group) GetMulti(keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	var mu sync.Mutex // 保护 results 和 local
+	var local []string
+	byPeer := make(map[PeerGetter][]string)
+
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue // 重复的 key 只获取一次
+		}
+		if key == "" {
+			results[key] = Result{Err: fmt.Errorf("%w: key is required", ErrBadRequest)}
+			continue
+		}
+		g.counters.gets.Add(1)
+		if v, ok := g.mainCache.get(key); ok {
+			g.counters.hits.Add(1)
+			results[key] = resultOf(key, v)
+			continue
+		}
+		results[key] = Result{} // 占位，用于去重
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				byPeer[peer] = append(byPeer[peer], key)
+				continue
+			}
+		}
+		local = append(local, key)
+	}
+
+	// 并发地向各个节点发送批量请求，失败的 key 转为本地加载
+	var wg sync.WaitGroup
+	for peer, peerKeys := range byPeer {
+		wg.Add(1)
+		go func(peer PeerGetter, peerKeys []string) {
+			defer wg.Done()
+			fetched := g.getMultiFromPeer(peer, peerKeys)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, key := range peerKeys {
+				r := fetched[key]
+				if r.Err != nil && fallbackLocally(r.Err) {
+					log.Println("[GeeCache] Failed to get from peer", r.Err)
+					local = append(local, key)
+					continue
+				}
+				results[key] = r
+			}
+		}(peer, peerKeys)
+	}
+	wg.Wait()
+
+	for key, r := range g.getMultiLocally(local) {
+		results[key] = r
+	}
+	return results
+}
+
+// getMultiFromPeer 从一个节点批量获取数据，节点不支持批量请求时逐个获取
+func (g *Group) getMultiFromPeer(peer PeerGetter, keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok {
+		for _, key := range keys {
+			v, err := g.getFromPeer(peer, key)
+			if err != nil {
+				results[key] = Result{Err: err}
+				continue
+			}
+			results[key] = resultOf(key, v)
+		}
+		return results
+	}
+
+	res := &pb.BatchResponse{}
+	err := bp.GetMulti(&pb.BatchRequest{Group: g.name, Keys: keys}, res)
+	if err == nil && len(res.GetResults()) != len(keys) {
+		err = fmt.Errorf("batch response has %d results for %d keys", len(res.GetResults()), len(keys))
+	}
+	for i, key := range keys {
+		if err != nil {
+			results[key] = Result{Err: err}
+			continue
+		}
+		v, err := DecodeResult(peerAddr(peer), res.GetResults()[i])
+		if err == nil {
+			g.counters.peerLoads.Add(1)
+		}
+		results[key] = Result{Value: v, Err: err}
+	}
+	return results
+}
+
+// getMultiLocally 在本地加载 keys。每个 key 都与 Get 共用 singleflight，
+// 同一个 key 的并发加载只会执行一次；Getter 实现了 BatchGetter 时并发地加载，
+// 由 batcher 在合并窗口内合并为尽量少的 GetMulti 调用
+func (g *Group) getMultiLocally(keys []string) map[string]Result {
+	results := make(map[string]Result, len(keys))
+	load := func(key string) Result {
+		viewi, err := g.loader.Do(key, func() (interface{}, error) {
+			return g.getLocally(key)
+		})
+		if err != nil {
+			return Result{Err: err}
+		}
+		return resultOf(key, viewi.(ByteView))
+	}
+	if g.batcher == nil {
+		for _, key := range keys {
+			results[key] = load(key)
+		}
+		return results
+	}
+
+	var mu sync.Mutex // 保护 results
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			r := load(key)
+			mu.Lock()
+			results[key] = r
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+	return results
+}
+
+// resultOf 把缓存中不存在的结果转换为 ErrNotFound
+func resultOf(key string, v ByteView) Result {
+	if v.notFound {
+		return Result{Err: notFoundError(key)}
+	}
+	return Result{Value: v}
+}
+
+// DecodeResult 把节点 peer 的批量响应中单个 key 的结果转换为 ByteView，
+// 远程节点返回的错误转换为 PeerError
+func DecodeResult(peer string, r *pb.Result) (ByteView, error) {
+	if e := r.GetError(); e != nil {
+		return ByteView{}, peerResultError(peer, e)
+	}
+	v, err := viewFromWire(r.GetValue(), r.GetEncoding())
+	v.expire, v.version = fromUnixMilli(r.GetExpire()), r.GetVersion()
+	v.contentType, v.flags = r.GetContentType(), r.GetFlags()
+	return v, err
+}
+
+// peerResultError 把批量响应中单个 key 的错误转换为 PeerError
+func peerResultError(peer string, e *pb.Error) *PeerError {
+	pe := &PeerError{Peer: peer, StatusCode: http.StatusInternalServerError, Code: e.GetCode(), Message: e.GetMessage()}
+	for _, k := range errorKinds {
+		if k.code == e.GetCode() {
+			pe.StatusCode = k.status
+			break
+		}
+	}
+	return pe
+}
+
+// batchResponse 在本地执行批量请求，结果的顺序与 keys 一致，accept 是请求方能够解压的格式
+func batchResponse(group *Group, keys []string, accept string) *pb.BatchResponse {
+	results := group.GetMulti(keys)
+	res := &pb.BatchResponse{Results: make([]*pb.Result, len(keys))}
+	for i, key := range keys {
+		r := &pb.Result{Key: key}
+		if err := results[key].Err; err != nil {
+			code, _ := errorCode(err)
+			r.Error = &pb.Error{Code: code, Message: err.Error()}
+		} else {
+			v := results[key].Value
+			b, encoding, err := wireValue(v, accept)
+			if err != nil {
+				r.Error = &pb.Error{Code: codeInternal, Message: err.Error()}
+				res.Results[i] = r
+				continue
+			}
+			r.Value, r.Encoding = b, encoding
+			r.Expire, r.Version = unixMilli(v.expire), v.version
+			r.ContentType, r.Flags = v.contentType, v.flags
+		}
+		res.Results[i] = r
+	}
+	return res
+}
+
+// serveBatch 处理 POST <basePath><group> 的批量请求，请求体和响应体分别是 BatchRequest 和 BatchResponse
+func (p *HTTPPool) serveBatch(w http.ResponseWriter, r *http.Request, group *Group) {
+	// 请求体与响应体一样受 maxResponseBytes 限制，多读一个字节用于判断是否超过上限
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, p.maxResponseBytes+1))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	if int64(len(body)) > p.maxResponseBytes {
+		writeError(w, r, fmt.Errorf("%w: request body exceeds %d bytes", ErrBadRequest, p.maxResponseBytes))
+		return
+	}
+	req := &pb.BatchRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		writeError(w, r, fmt.Errorf("%w: decoding request body: %v", ErrBadRequest, err))
+		return
+	}
+	out, err := proto.Marshal(batchResponse(group, req.GetKeys(), r.Header.Get(acceptEncodingHeader)))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(out)
+}
+
+// GetMulti 用一次 POST 请求从远程节点获取多个 key
+func (h *httpGetter) GetMulti(in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, h.baseURL+url.QueryEscape(in.GetGroup()), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", protobufMediaType)
+	req.Header.Set(acceptEncodingHeader, acceptedEncodings())
+	res, err := h.pool.do(req)
+	h.pool.observe(h.peer, err == nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return readError(h.peer, res)
+	}
+
+	limit := h.pool.maxResponseBytes
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("reading response body: %v", err)
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("response body exceeds %d bytes", limit)
+	}
+	if err = proto.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return nil
+}
+
+// 确保 httpGetter 和 grpcGetter 实现了 BatchPeerGetter 接口
+var (
+	_ BatchPeerGetter = (*httpGetter)(nil)
+	_ BatchPeerGetter = (*grpcGetter)(nil)
+)
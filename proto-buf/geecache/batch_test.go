@@ -0,0 +1,161 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// batchDB 同时实现了 Getter 和 BatchGetter，记录批量加载的次数
+type batchDB struct {
+	mu      sync.Mutex
+	name    string
+	batches int
+}
+
+func (db *batchDB) Get(key string) ([]byte, error) {
+	return nil, errors.New("Get should not be called when GetMulti is available")
+}
+
+func (db *batchDB) GetMulti(keys []string) (map[string][]byte, error) {
+	db.mu.Lock()
+	db.batches++
+	db.mu.Unlock()
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if key != "missing" {
+			values[key] = []byte(db.name + "-" + key)
+		}
+	}
+	return values, nil
+}
+
+// peerGroup 创建与远程同名但不注册到全局的 group，模拟另一个节点上的同一个 group
+func peerGroup(name string, getter Getter) *Group {
+	return newGroup(name, 2<<10, getter)
+}
+
+func TestGetMulti(t *testing.T) {
+	remoteDB := &batchDB{name: "remote"}
+	NewGroup("batch-scores", 2<<10, remoteDB).SetBatchWindow(50*time.Millisecond, 100)
+	var mu sync.Mutex
+	requests := 0
+	pool := NewHTTPPool("http://remote")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		pool.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	localDB := &batchDB{name: "local"}
+	g := peerGroup("batch-scores", localDB)
+	g.SetBatchWindow(50*time.Millisecond, 100)
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", server.URL)
+	g.RegisterPeers(p)
+
+	var keys []string
+	owner := make(map[string]string)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		keys = append(keys, key)
+		owner[key] = "local"
+		if _, ok := p.PickPeer(key); ok {
+			owner[key] = "remote"
+		}
+	}
+	keys = append(keys, "missing", "key0", "")
+
+	results := g.GetMulti(keys)
+	for key, o := range owner {
+		if r := results[key]; r.Err != nil || r.Value.String() != o+"-"+key {
+			t.Errorf("GetMulti[%s] = %q, %v, want %q", key, r.Value.String(), r.Err, o+"-"+key)
+		}
+	}
+	if err := results["missing"].Err; !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetMulti[missing] error = %v, want ErrNotFound", err)
+	}
+	if err := results[""].Err; !errors.Is(err, ErrBadRequest) {
+		t.Errorf("GetMulti[\"\"] error = %v, want ErrBadRequest", err)
+	}
+	if requests != 1 || remoteDB.batches != 1 || localDB.batches != 1 {
+		t.Errorf("got %d requests, %d remote batches, %d local batches, want 1 each",
+			requests, remoteDB.batches, localDB.batches)
+	}
+}
+
+func TestBatchWindow(t *testing.T) {
+	db := &batchDB{name: "db"}
+	g := NewGroup("batch-window", 2<<10, db)
+	g.SetBatchWindow(50*time.Millisecond, 8)
+
+	// 20 个不同的 key 并发加载，每个 key 请求两次：
+	// 同一个 key 由 singleflight 合并，不同的 key 按上限 8 合并为 3 次批量加载
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if v, err := g.Get(key); err != nil || v.String() != "db-"+key {
+				t.Errorf("Get(%s) = %q, %v", key, v.String(), err)
+			}
+		}(fmt.Sprintf("key%d", i%20))
+	}
+	wg.Wait()
+	if db.batches != 3 {
+		t.Errorf("got %d batches, want 3", db.batches)
+	}
+
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+// panicDB 的批量加载总是 panic
+type panicDB struct{ batchDB }
+
+func (db *panicDB) GetMulti(keys []string) (map[string][]byte, error) {
+	panic("boom")
+}
+
+func TestBatchPanic(t *testing.T) {
+	b := newBatchLoader(&panicDB{})
+	b.window = 10 * time.Millisecond
+	// 批次在定时器的 goroutine 中加载，panic 不能使进程退出，同一批次中的调用方都得到错误
+	var wg sync.WaitGroup
+	for _, key := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := b.load(key); !errors.Is(err, errBatchPanicked) {
+				t.Errorf("load(%s) error = %v, want errBatchPanicked", key, err)
+			}
+		}(key)
+	}
+	wg.Wait()
+}
+
+func TestServeBatchBodyLimit(t *testing.T) {
+	NewGroup("batch-limit", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	p := NewHTTPPool("http://remote", WithMaxResponseSize(16))
+	body, _ := proto.Marshal(&pb.BatchRequest{Group: "batch-limit", Keys: []string{"a-key-longer-than", "the-limit"}})
+	r := httptest.NewRequest(http.MethodPost, defaultBasePath+"batch-limit", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "exceeds 16 bytes") {
+		t.Errorf("oversized batch request = %d %q, want 400 with the limit", w.Code, w.Body.String())
+	}
+}
@@ -1,25 +1,83 @@
 package geecache
 
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
 // ByteView 表示字节数据的不可变视图
 type ByteView struct {
-	b []byte // 存储字节数据
+	b           []byte    // 存储字节数据
+	codec       Codec     // 不为 nil 时 b 是压缩后的数据
+	expire      time.Time // 过期时间，零值表示不过期
+	version     uint64    // 版本，从数据源加载时的纳秒时间戳
+	notFound    bool      // 表示 key 不存在的缓存条目，用于缓存不存在的结果
+	contentType string    // 写入时指定的媒体类型，为空表示未知
+	flags       uint32    // 写入时指定的客户端标志，例如 memcached 协议的 flags
 }
 
-// Len 返回视图的长度
+// Len 返回视图占用的字节数，压缩存储时是压缩后的长度
 func (v ByteView) Len() int {
 	return len(v.b) // 返回字节数据的长度
 }
 
-// ByteSlice 返回字节数据的副本
+// Bytes 返回字节数据的副本，压缩存储时返回解压后的数据，解压失败时返回错误
+func (v ByteView) Bytes() ([]byte, error) {
+	if v.codec != nil {
+		b, err := v.codec.Decode(v.b)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s value: %v", v.codec.Name(), err)
+		}
+		return b, nil // 解压得到的是新的切片，不需要再复制
+	}
+	return cloneBytes(v.b), nil // 返回字节数据的副本
+}
+
+// ByteSlice 与 Bytes 相同，解压失败时记录日志并返回 nil。
+// 向客户端返回数据时应该使用 Bytes，避免把损坏的数据当作空值返回
 func (v ByteView) ByteSlice() []byte {
-	return cloneBytes(v.b) // 返回字节数据的副本
+	b, err := v.Bytes()
+	if err != nil {
+		// 压缩的数据来自本节点或校验过的远程节点，解压失败说明数据已损坏
+		log.Printf("[GeeCache] %v", err)
+	}
+	return b
 }
 
 // String 返回字节数据的字符串表示，如果必要会进行复制
 func (v ByteView) String() string {
+	if v.codec != nil {
+		return string(v.ByteSlice())
+	}
 	return string(v.b) // 将字节数据转换为字符串并返回
 }
 
+// Expire 返回过期时间，零值表示不过期
+func (v ByteView) Expire() time.Time {
+	return v.expire
+}
+
+// Version 返回 value 的版本，数值越大越新，0 表示未知
+func (v ByteView) Version() uint64 {
+	return v.version
+}
+
+// ContentType 返回写入 value 时指定的媒体类型，从数据源加载的 value 为空
+func (v ByteView) ContentType() string {
+	return v.contentType
+}
+
+// Flags 返回写入 value 时指定的客户端标志，从数据源加载的 value 为 0
+func (v ByteView) Flags() uint32 {
+	return v.flags
+}
+
+// expired 判断在 now 时是否已经过期
+func (v ByteView) expired(now time.Time) bool {
+	return !v.expire.IsZero() && !now.Before(v.expire)
+}
+
 // cloneBytes 克隆字节数据，返回一个新的副本
 func cloneBytes(b []byte) []byte {
 	c := make([]byte, len(b)) // 创建一个新的字节切片
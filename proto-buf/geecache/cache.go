@@ -2,7 +2,9 @@ package geecache
 
 import (
 	"Cache/proto-buf/geecache/lru"
+	"sort"
 	"sync"
+	"time"
 )
 
 type cache struct {
@@ -35,10 +37,119 @@ func (c *cache) get(key string) (value ByteView, ok bool) {
 		return
 	}
 
-	// 从 LRU 缓存中获取键对应的值
+	// 从 LRU 缓存中获取键对应的值，已过期的条目视为未命中并删除
 	if v, ok := c.lru.Get(key); ok {
+		if v.(ByteView).expired(time.Now()) {
+			c.lru.Remove(key)
+			return ByteView{}, false
+		}
 		return v.(ByteView), ok // 将缓存中的值转换为 ByteView 并返回
 	}
 
 	return // 如果没有找到，返回默认值
 }
+
+// remove 从缓存中删除一个键，返回该键之前是否存在
+func (c *cache) remove(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return false
+	}
+	if _, ok := c.lru.Get(key); !ok {
+		return false
+	}
+	c.lru.Remove(key)
+	return true
+}
+
+// touch 修改缓存中一个键的过期时间，返回该键是否存在
+func (c *cache) touch(key string, expire time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return false
+	}
+	v, ok := c.lru.Get(key)
+	if !ok || v.(ByteView).expired(time.Now()) {
+		return false
+	}
+	view := v.(ByteView)
+	view.expire = expire
+	c.lru.Add(key, view)
+	return true
+}
+
+// stats 返回缓存中的条目数和占用的字节数
+func (c *cache) stats() (items int, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return 0, 0
+	}
+	return c.lru.Len(), c.lru.Bytes()
+}
+
+// keys 返回至多 limit 个未过期的键，按从新到旧排列，limit 小于等于 0 时返回全部。
+// 缓存的不存在结果不包括在内
+func (c *cache) keys(limit int) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return nil
+	}
+	now := time.Now()
+	var keys []string
+	c.lru.Walk(func(key string, value lru.Value) bool {
+		if limit > 0 && len(keys) == limit {
+			return false
+		}
+		if v := value.(ByteView); !v.notFound && !v.expired(now) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// entry 是缓存中的一个键值对
+type entry struct {
+	key   string
+	value ByteView
+}
+
+// hottest 返回 score 最高的至多 n 个未过期的条目，score 相同时最近访问的排在前面。
+// 缓存的不存在结果很快过期，不包括在内
+func (c *cache) hottest(n int, score func(key string) float64) []entry {
+	c.mu.Lock()
+	if c.lru == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	var entries []entry
+	c.lru.Walk(func(key string, value lru.Value) bool {
+		if v := value.(ByteView); !v.notFound && !v.expired(now) {
+			entries = append(entries, entry{key, v})
+		}
+		return true
+	})
+	c.mu.Unlock()
+
+	// Walk 按从新到旧的顺序遍历，稳定排序保留了相同 score 之间的访问顺序
+	scores := make(map[string]float64, len(entries))
+	for _, e := range entries {
+		scores[e.key] = score(e.key)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return scores[entries[i].key] > scores[entries[j].key]
+	})
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
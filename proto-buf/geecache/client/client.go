@@ -0,0 +1,381 @@
+// Package client 是应用程序访问 geecache 集群的客户端。
+// 它与节点使用同样的方式构建哈希环，把每个 key 直接发送给负责它的节点，
+// 不需要经过 API 服务或者由任意节点转发，因此只比节点之间的请求多一跳。
+package client
+
+import (
+	"Cache/proto-buf/geecache"
+	"Cache/proto-buf/geecache/consistenthash"
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	defaultTimeout  = 5 * time.Second
+	defaultAttempts = 2
+	defaultRefresh  = 10 * time.Second
+)
+
+// ErrNoPeers 表示还没有可用的节点
+var ErrNoPeers = errors.New("client: no peers")
+
+// PeerSource 提供集群的节点列表，*discovery.DNS 实现了该接口
+type PeerSource interface {
+	Peers() []string
+}
+
+// Config 是客户端的配置
+type Config struct {
+	Peers           []string        // 集群中的全部节点，格式与节点配置中的 peers 相同
+	Members         []geecache.Peer // 带权重和故障域的节点，与节点列表配置文件中的 peers 相同，不为空时忽略 Peers
+	Discovery       PeerSource      // 不为 nil 时周期性地从中获取节点列表，Peers 和 Members 都为空时以它的结果作为初始列表
+	RefreshInterval time.Duration   // 从 Discovery 刷新节点列表的间隔，默认为 10s
+
+	Transport string        // 与集群一致的节点间通信方式：http（默认）、grpc 或 tcp
+	Timeout   time.Duration // 单次请求的超时时间，默认为 5s
+	Attempts  int           // 每个 key 最多尝试的节点数，第一个为负责节点，之后沿哈希环依次重试，默认为 2
+
+	// MaxIdleConnsPerPeer 和 MaxConnsPerPeer 限制 http 时与每个节点的连接池，0 表示使用默认值。
+	// grpc 和 tcp 与每个节点只保持一个多路复用的连接，不需要连接池
+	MaxIdleConnsPerPeer int
+	MaxConnsPerPeer     int
+	HTTPOptions         []geecache.HTTPPoolOption // http 时额外的选项，例如 WithSigner、WithTLS
+	DialOptions         []grpc.DialOption         // grpc 时连接节点的选项，默认不加密
+
+	Logf func(string, ...any) // 可选的日志函数
+}
+
+// pool 是客户端使用的节点池，HTTPPool、GRPCPool 和 TCPPool 都实现了该接口
+type pool interface {
+	Ring() *consistenthash.Map
+	Getter(peer string) (geecache.PeerGetter, bool)
+}
+
+// Client 把请求直接发送给负责 key 的节点，可以被多个 goroutine 同时使用
+type Client struct {
+	cfg   Config
+	pool  pool
+	set   func(members []geecache.Peer) error // 更新节点池的节点列表
+	close func() error                        // 关闭与节点的连接
+
+	mu      sync.Mutex // 保护 members
+	members []geecache.Peer
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New 创建客户端。节点池以空地址作为当前节点，因此哈希环上的每个节点都是远程节点
+func New(cfg Config) (*Client, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = defaultAttempts
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefresh
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	members := cfg.Members
+	if len(members) == 0 {
+		peers := cfg.Peers
+		if len(peers) == 0 && cfg.Discovery != nil {
+			peers = cfg.Discovery.Peers()
+		}
+		members = plainMembers(peers)
+	}
+	if len(members) == 0 {
+		return nil, ErrNoPeers
+	}
+
+	c := &Client{cfg: cfg, done: make(chan struct{})}
+	switch cfg.Transport {
+	case "", "http":
+		opts := []geecache.HTTPPoolOption{geecache.WithTimeout(cfg.Timeout)}
+		if cfg.MaxIdleConnsPerPeer > 0 {
+			opts = append(opts, geecache.WithMaxIdleConnsPerPeer(cfg.MaxIdleConnsPerPeer))
+		}
+		if cfg.MaxConnsPerPeer > 0 {
+			opts = append(opts, geecache.WithMaxConnsPerPeer(cfg.MaxConnsPerPeer))
+		}
+		p := geecache.NewHTTPPool("", append(opts, cfg.HTTPOptions...)...)
+		c.pool = p
+		c.set = func(members []geecache.Peer) error { p.SetPeers(members...); return nil }
+		c.close = func() error { return nil }
+	case "grpc":
+		p := geecache.NewGRPCPool("", cfg.DialOptions...)
+		p.SetTimeout(cfg.Timeout)
+		c.pool, c.set, c.close = p, func(members []geecache.Peer) error { return p.Set(addrs(members)...) }, p.Close
+	case "tcp":
+		p := geecache.NewTCPPool("")
+		p.SetTimeout(cfg.Timeout)
+		c.pool, c.set, c.close = p, func(members []geecache.Peer) error { p.Set(addrs(members)...); return nil }, p.Close
+	default:
+		return nil, fmt.Errorf("client: unknown transport %q", cfg.Transport)
+	}
+	if err := c.SetMembers(members...); err != nil {
+		c.close()
+		return nil, err
+	}
+	if cfg.Discovery != nil {
+		c.wg.Add(1)
+		go c.watch()
+	}
+	return c, nil
+}
+
+// SetPeers 更新节点列表，仍在列表中的节点复用已有的连接
+func (c *Client) SetPeers(peers ...string) error {
+	return c.SetMembers(plainMembers(peers)...)
+}
+
+// SetMembers 与 SetPeers 相同，但节点带有权重和故障域。
+// 只有 http 按权重构建哈希环，grpc 和 tcp 只使用节点的地址
+func (c *Client) SetMembers(members ...geecache.Peer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.set(members); err != nil {
+		return err
+	}
+	c.members = append([]geecache.Peer(nil), members...)
+	return nil
+}
+
+// plainMembers 把地址列表转换为默认权重、没有故障域的节点
+func plainMembers(peers []string) []geecache.Peer {
+	members := make([]geecache.Peer, len(peers))
+	for i, addr := range peers {
+		members[i] = geecache.Peer{Addr: addr}
+	}
+	return members
+}
+
+// addrs 返回节点的地址
+func addrs(members []geecache.Peer) []string {
+	peers := make([]string, len(members))
+	for i, m := range members {
+		peers[i] = m.Addr
+	}
+	return peers
+}
+
+// Peers 返回当前的节点列表
+func (c *Client) Peers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return addrs(c.members)
+}
+
+// merge 把 Discovery 返回的地址转换为节点。当前的节点和 Members 中的节点保留原来的权重和故障域，
+// 新出现的地址使用默认权重
+func (c *Client) merge(peers []string) []geecache.Peer {
+	known := make(map[string]geecache.Peer)
+	for _, m := range c.cfg.Members {
+		known[m.Addr] = m
+	}
+	c.mu.Lock()
+	for _, m := range c.members {
+		known[m.Addr] = m
+	}
+	c.mu.Unlock()
+
+	members := make([]geecache.Peer, len(peers))
+	for i, addr := range peers {
+		if m, ok := known[addr]; ok {
+			members[i] = m
+		} else {
+			members[i] = geecache.Peer{Addr: addr}
+		}
+	}
+	return members
+}
+
+// watch 周期性地从 Discovery 获取节点列表，变化时更新哈希环
+func (c *Client) watch() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		peers := c.cfg.Discovery.Peers()
+		if len(peers) == 0 || equal(peers, c.Peers()) {
+			continue // 发现服务暂时没有结果时保留原来的节点
+		}
+		if err := c.SetMembers(c.merge(peers)...); err != nil {
+			c.cfg.Logf("[geecache client] updating peers: %v", err)
+			continue
+		}
+		c.cfg.Logf("[geecache client] peers changed: %v", peers)
+	}
+}
+
+// Close 停止刷新节点列表并关闭与节点的连接，重复调用时直接返回 nil
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.wg.Wait()
+		err = c.close()
+	})
+	return err
+}
+
+// replicas 返回依次尝试的节点，第一个为负责 key 的节点
+func (c *Client) replicas(ring *consistenthash.Map, key string) []string {
+	if ring == nil {
+		return nil
+	}
+	return ring.GetN(key, c.cfg.Attempts)
+}
+
+// Get 从负责 key 的节点获取 group 中 key 的值，节点不可用时依次尝试哈希环上的下一个节点。
+// key 不存在时返回的错误满足 errors.Is(err, geecache.ErrNotFound)
+func (c *Client) Get(group, key string) (geecache.ByteView, error) {
+	if key == "" {
+		return geecache.ByteView{}, fmt.Errorf("%w: key is required", geecache.ErrBadRequest)
+	}
+	replicas := c.replicas(c.pool.Ring(), key)
+	if len(replicas) == 0 {
+		return geecache.ByteView{}, ErrNoPeers
+	}
+	var err error
+	for _, peer := range replicas {
+		var v geecache.ByteView
+		if v, err = c.getFrom(peer, group, key); err == nil || !retryable(err) {
+			return v, err
+		}
+		c.cfg.Logf("[geecache client] get %s/%s from %s: %v", group, key, peer, err)
+	}
+	return geecache.ByteView{}, err
+}
+
+// getFrom 从节点 peer 获取一个 key
+func (c *Client) getFrom(peer, group, key string) (geecache.ByteView, error) {
+	getter, ok := c.pool.Getter(peer)
+	if !ok {
+		return geecache.ByteView{}, fmt.Errorf("%w: %s is no longer a peer", geecache.ErrUnavailable, peer)
+	}
+	res := &pb.Response{}
+	if err := getter.Get(&pb.Request{Group: group, Key: key}, res); err != nil {
+		return geecache.ByteView{}, err
+	}
+	return geecache.DecodeResponse(key, res)
+}
+
+// GetMulti 获取 group 中的多个 key。key 按负责的节点分组，每个节点只发送一次批量请求，
+// 失败的 key 再按哈希环上的下一个节点分组重试。返回值按 key 索引，每个 key 都有各自的结果或错误
+func (c *Client) GetMulti(group string, keys []string) map[string]geecache.Result {
+	results := make(map[string]geecache.Result, len(keys))
+	ring := c.pool.Ring()
+	pending := make(map[string][]string) // 尚未完成的 key 及其剩余可以尝试的节点
+	for _, key := range keys {
+		if _, ok := results[key]; ok {
+			continue // 重复的 key 只获取一次
+		}
+		switch replicas := c.replicas(ring, key); {
+		case key == "":
+			results[key] = geecache.Result{Err: fmt.Errorf("%w: key is required", geecache.ErrBadRequest)}
+		case len(replicas) == 0:
+			results[key] = geecache.Result{Err: ErrNoPeers}
+		default:
+			results[key] = geecache.Result{} // 占位，用于去重
+			pending[key] = replicas
+		}
+	}
+
+	for len(pending) > 0 {
+		byPeer := make(map[string][]string)
+		for key, replicas := range pending {
+			byPeer[replicas[0]] = append(byPeer[replicas[0]], key)
+		}
+		var mu sync.Mutex // 保护 results 和 pending
+		var wg sync.WaitGroup
+		for peer, peerKeys := range byPeer {
+			wg.Add(1)
+			go func(peer string, peerKeys []string) {
+				defer wg.Done()
+				fetched := c.getMultiFrom(peer, group, peerKeys)
+				mu.Lock()
+				defer mu.Unlock()
+				for _, key := range peerKeys {
+					r := fetched[key]
+					results[key] = r
+					if r.Err != nil && retryable(r.Err) && len(pending[key]) > 1 {
+						pending[key] = pending[key][1:]
+						continue
+					}
+					delete(pending, key)
+				}
+			}(peer, peerKeys)
+		}
+		wg.Wait()
+	}
+	return results
+}
+
+// getMultiFrom 从节点 peer 批量获取 keys，节点不支持批量请求时逐个获取
+func (c *Client) getMultiFrom(peer, group string, keys []string) map[string]geecache.Result {
+	results := make(map[string]geecache.Result, len(keys))
+	getter, ok := c.pool.Getter(peer)
+	bp, batch := getter.(geecache.BatchPeerGetter)
+	if !ok || !batch {
+		for _, key := range keys {
+			v, err := c.getFrom(peer, group, key)
+			results[key] = geecache.Result{Value: v, Err: err}
+		}
+		return results
+	}
+
+	res := &pb.BatchResponse{}
+	err := bp.GetMulti(&pb.BatchRequest{Group: group, Keys: keys}, res)
+	if err == nil && len(res.GetResults()) != len(keys) {
+		err = fmt.Errorf("batch response has %d results for %d keys", len(res.GetResults()), len(keys))
+	}
+	if err != nil {
+		c.cfg.Logf("[geecache client] get %d keys of %s from %s: %v", len(keys), group, peer, err)
+	}
+	for i, key := range keys {
+		if err != nil {
+			results[key] = geecache.Result{Err: err}
+			continue
+		}
+		v, err := geecache.DecodeResult(peer, res.GetResults()[i])
+		results[key] = geecache.Result{Value: v, Err: err}
+	}
+	return results
+}
+
+// retryable 判断请求失败后是否应该尝试下一个节点。
+// 节点已经确认 key 或 group 不存在、请求不合法或者拒绝访问时，换一个节点只会得到同样的结果
+func retryable(err error) bool {
+	return !errors.Is(err, geecache.ErrNotFound) && !errors.Is(err, geecache.ErrNoSuchGroup) &&
+		!errors.Is(err, geecache.ErrBadRequest) &&
+		!errors.Is(err, geecache.ErrUnauthenticated) && !errors.Is(err, geecache.ErrForbidden)
+}
+
+// equal 判断两个节点列表是否相同
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
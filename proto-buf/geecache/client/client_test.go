@@ -0,0 +1,187 @@
+package client
+
+import (
+	"Cache/proto-buf/geecache"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// 所有节点在同一个进程中，共用一个没有注册节点池的 group，每个节点都在本地加载
+var scores = geecache.NewGroup("client-scores", 2<<10, geecache.GetterFunc(func(key string) ([]byte, error) {
+	if key == "kkk" {
+		return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+	}
+	return []byte("score of " + key), nil
+}))
+
+// counter 记录每个节点收到的请求数
+type counter struct {
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func (c *counter) add(peer string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hits[peer]++
+}
+
+func (c *counter) get(peer string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits[peer]
+}
+
+func TestClientHTTP(t *testing.T) {
+	hits := &counter{hits: map[string]int{}}
+	var peers []string
+	var servers []*httptest.Server
+	pool := geecache.NewHTTPPool("")
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.add("http://" + r.Host)
+			pool.ServeHTTP(w, r)
+		}))
+		peers = append(peers, srv.URL)
+		servers = append(servers, srv)
+		defer srv.Close()
+	}
+	c, err := New(Config{Peers: peers, Logf: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 每个 key 只发给负责它的节点
+	ring := c.pool.Ring()
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		owner := ring.Get(key)
+		before := hits.get(owner)
+		v, err := c.Get("client-scores", key)
+		if err != nil || v.String() != "score of "+key {
+			t.Fatalf("Get(%s) = %q, %v", key, v.String(), err)
+		}
+		if hits.get(owner) != before+1 {
+			t.Errorf("Get(%s) was not sent to its owner %s", key, owner)
+		}
+	}
+	if _, err := c.Get("client-scores", "kkk"); !errors.Is(err, geecache.ErrNotFound) {
+		t.Errorf("Get(kkk) error = %v, want ErrNotFound", err)
+	}
+
+	// 负责节点下线后由哈希环上的下一个节点处理
+	var key string
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprint("key", i); ring.Get(k) == servers[0].URL {
+			key = k
+		}
+	}
+	servers[0].Close()
+	if v, err := c.Get("client-scores", key); err != nil || v.String() != "score of "+key {
+		t.Errorf("Get(%s) after owner is down = %q, %v", key, v.String(), err)
+	}
+
+	results := c.GetMulti("client-scores", []string{"Tom", key, "kkk", "Tom"})
+	if len(results) != 3 {
+		t.Fatalf("GetMulti returned %d results, want 3", len(results))
+	}
+	for _, k := range []string{"Tom", key} {
+		if r := results[k]; r.Err != nil || r.Value.String() != "score of "+k {
+			t.Errorf("GetMulti[%s] = %q, %v", k, r.Value.String(), r.Err)
+		}
+	}
+	if err := results["kkk"].Err; !errors.Is(err, geecache.ErrNotFound) {
+		t.Errorf("GetMulti[kkk] error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestClientMembers(t *testing.T) {
+	hits := &counter{hits: map[string]int{}}
+	pool := geecache.NewHTTPPool("")
+	var members []geecache.Peer
+	for i := 0; i < 2; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.add("http://" + r.Host)
+			pool.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		members = append(members, geecache.Peer{Addr: srv.URL, Weight: 1 + i*3})
+	}
+	c, err := New(Config{Members: members, Attempts: 2, Logf: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close() // 与下面的 Close 一起验证重复关闭不会 panic
+	if peers := c.Peers(); len(peers) != 2 || peers[0] != members[0].Addr || peers[1] != members[1].Addr {
+		t.Fatalf("Peers() = %v, want the addresses of the members", peers)
+	}
+
+	// 权重为 4 的节点负责的 key 更多
+	owned := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		owned[c.pool.Ring().Get(fmt.Sprint("key", i))]++
+	}
+	if owned[members[1].Addr] <= owned[members[0].Addr]*2 {
+		t.Errorf("weighted ring owns %v, want most keys on %s", owned, members[1].Addr)
+	}
+
+	// Discovery 刷新节点列表后已知节点保留权重，新节点使用默认权重
+	merged := c.merge([]string{members[1].Addr, "http://new", members[0].Addr})
+	want := []geecache.Peer{members[1], {Addr: "http://new"}, members[0]}
+	if fmt.Sprint(merged) != fmt.Sprint(want) {
+		t.Errorf("merge() = %v, want %v", merged, want)
+	}
+
+	// group 不存在时每个节点的结果都一样，不再重试下一个节点
+	if _, err := c.Get("client-missing", "Tom"); !errors.Is(err, geecache.ErrNoSuchGroup) {
+		t.Fatalf("Get from unknown group error = %v, want ErrNoSuchGroup", err)
+	}
+	if n := hits.get(members[0].Addr) + hits.get(members[1].Addr); n != 1 {
+		t.Errorf("Get from unknown group sent %d requests, want 1", n)
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestClientTCP(t *testing.T) {
+	var peers []string
+	for i := 0; i < 2; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := geecache.NewTCPPool(l.Addr().String())
+		go p.Serve(l)
+		defer l.Close()
+		peers = append(peers, l.Addr().String())
+	}
+	c, err := New(Config{Peers: peers, Transport: "tcp", Logf: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if v, err := c.Get("client-scores", "Tom"); err != nil || v.String() != "score of Tom" {
+		t.Errorf("Get(Tom) = %q, %v", v.String(), err)
+	}
+	results := c.GetMulti("client-scores", []string{"Tom", "Jack", "kkk"})
+	if r := results["Jack"]; r.Err != nil || r.Value.String() != "score of Jack" {
+		t.Errorf("GetMulti[Jack] = %q, %v", r.Value.String(), r.Err)
+	}
+	if err := results["kkk"].Err; !errors.Is(err, geecache.ErrNotFound) {
+		t.Errorf("GetMulti[kkk] error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := New(Config{}); err != ErrNoPeers {
+		t.Errorf("New without peers: %v, want ErrNoPeers", err)
+	}
+	if _, err := New(Config{Peers: peers, Transport: "udp"}); err == nil {
+		t.Errorf("New with unknown transport succeeded")
+	}
+}
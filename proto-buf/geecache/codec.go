@@ -0,0 +1,157 @@
+package geecache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// acceptEncodingHeader 列出请求方能够解压的格式，远程节点据此决定是否直接发送压缩后的数据。
+// gRPC 中使用同名的 metadata
+const (
+	acceptEncodingHeader = "X-Geecache-Accept-Encoding"
+	encodingHeader       = "X-Geecache-Encoding" // 分块传输的 value 的压缩格式
+)
+
+// Codec 用于压缩缓存中的 value，Name 用于在节点之间标识压缩格式
+type Codec interface {
+	Name() string
+	Encode(b []byte) ([]byte, error)
+	Decode(b []byte) ([]byte, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{"gzip": GzipCodec{}}
+)
+
+// RegisterCodec 注册一种压缩格式，当前节点才能解压其他节点发来的这种格式的数据
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// codecByName 返回已注册的压缩格式
+func codecByName(name string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// acceptedEncodings 返回所有已注册的压缩格式，以逗号分隔
+func acceptedEncodings() string {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// GzipCodec 使用 gzip 压缩，Level 为 0 时使用默认的压缩级别。
+// 解压后超过 MaxSize 字节时解压失败，为 0 时与节点间默认的最大响应体大小相同
+type GzipCodec struct {
+	Level   int
+	MaxSize int64
+}
+
+// Name 实现了 Codec 接口
+func (c GzipCodec) Name() string {
+	return "gzip"
+}
+
+// Encode 实现了 Codec 接口
+func (c GzipCodec) Encode(b []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(b); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode 实现了 Codec 接口
+func (c GzipCodec) Decode(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	limit := c.MaxSize
+	if limit <= 0 {
+		limit = defaultMaxResponseBytes
+	}
+	// 少量压缩数据可以解压出极大的内容，按上限读取
+	out, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > limit {
+		return nil, fmt.Errorf("decoded value exceeds %d bytes", limit)
+	}
+	return out, nil
+}
+
+// SetCodec 设置 Group 的压缩格式，value 以压缩后的形式存入缓存并在节点之间传输，
+// cacheBytes 按压缩后的大小计算。需要在 Group 开始使用前调用
+func (g *Group) SetCodec(c Codec) {
+	g.codec = c
+}
+
+// compress 按 Group 的压缩格式压缩 value，压缩失败或者没有变小时保留原始数据
+func (g *Group) compress(v ByteView) ByteView {
+	if g.codec == nil || v.codec != nil {
+		return v
+	}
+	enc, err := g.codec.Encode(v.b)
+	if err != nil || len(enc) >= len(v.b) {
+		return v
+	}
+	v.b, v.codec = enc, g.codec
+	return v
+}
+
+// viewFromWire 把远程节点发来的数据转换为 ByteView，压缩的数据保持压缩
+func viewFromWire(b []byte, encoding string) (ByteView, error) {
+	if encoding == "" {
+		return ByteView{b: b}, nil
+	}
+	c, ok := codecByName(encoding)
+	if !ok {
+		return ByteView{}, fmt.Errorf("unknown encoding %q", encoding)
+	}
+	return ByteView{b: b, codec: c}, nil
+}
+
+// wireValue 返回发送给请求方的数据和压缩格式。请求方能够解压时直接发送压缩后的数据，否则先解压
+func wireValue(v ByteView, accept string) ([]byte, string, error) {
+	if v.codec == nil {
+		return v.b, "", nil
+	}
+	for _, name := range strings.Split(accept, ",") {
+		if strings.TrimSpace(name) == v.codec.Name() {
+			return v.b, v.codec.Name(), nil
+		}
+	}
+	b, err := v.Bytes()
+	return b, "", err
+}
@@ -0,0 +1,77 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroupCodec(t *testing.T) {
+	// 10 个 8KB 的 JSON value，未压缩时 4KB 的缓存一个也放不下
+	blob := func(key string) string {
+		return "[" + strings.Repeat(`{"key":"`+key+`","score":630},`, 400) + "{}]"
+	}
+	loads := 0
+	g := NewGroup("codec-json", 4<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(blob(key)), nil
+	}))
+	g.SetCodec(GzipCodec{})
+
+	keys := []string{"k0", "k1", "k2", "k3", "k4", "k5", "k6", "k7", "k8", "k9"}
+	for round := 0; round < 2; round++ {
+		for _, key := range keys {
+			v, err := g.Get(key)
+			if err != nil || v.String() != blob(key) || string(v.ByteSlice()) != blob(key) {
+				t.Fatalf("Get(%s) returned a corrupted value, err %v", key, err)
+			}
+		}
+	}
+	if loads != len(keys) {
+		t.Errorf("compressed values should all fit in the cache, loaded %d times", loads)
+	}
+	if v, _ := g.mainCache.get("k0"); v.codec == nil || v.Len() >= len(blob("k0"))/5 {
+		t.Errorf("cached value should be stored compressed, got %d bytes", v.Len())
+	}
+
+	// 远程节点直接发送压缩后的数据，请求方读取时透明解压
+	server := httptest.NewServer(NewHTTPPool("http://remote"))
+	defer server.Close()
+	p := NewHTTPPool("http://self")
+	p.Set(server.URL)
+	peer, _ := p.PickPeer("k1")
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "codec-json", Key: "k1"}, res); err != nil {
+		t.Fatalf("Get from peer failed: %v", err)
+	}
+	if res.GetEncoding() != "gzip" || len(res.GetValue()) >= len(blob("k1")) {
+		t.Errorf("expect a gzip encoded value on the wire, got %q with %d bytes", res.GetEncoding(), len(res.GetValue()))
+	}
+	if v, err := viewFromWire(res.GetValue(), res.GetEncoding()); err != nil || v.String() != blob("k1") {
+		t.Errorf("decoding the wire value failed: %v", err)
+	}
+
+	// 小 value 压缩后不会变小，保持原样存放
+	if v := g.compress(ByteView{b: []byte("630")}); v.codec != nil {
+		t.Errorf("tiny values should not be compressed")
+	}
+}
+
+func TestGzipDecodeLimit(t *testing.T) {
+	c := GzipCodec{MaxSize: 1 << 10}
+	small, _ := c.Encode([]byte(strings.Repeat("a", 1<<10)))
+	if b, err := c.Decode(small); err != nil || len(b) != 1<<10 {
+		t.Fatalf("Decode at the limit = %d bytes, %v", len(b), err)
+	}
+	// 压缩后很小的数据解压后超过上限
+	bomb, _ := c.Encode([]byte(strings.Repeat("a", 1<<20)))
+	if _, err := c.Decode(bomb); err == nil {
+		t.Fatalf("Decode over the limit should fail")
+	}
+
+	v := ByteView{b: bomb, codec: c}
+	if b, err := v.Bytes(); err == nil || b != nil {
+		t.Fatalf("Bytes of an oversized value = %d bytes, %v", len(b), err)
+	}
+}
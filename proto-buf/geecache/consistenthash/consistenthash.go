@@ -35,19 +35,50 @@ func New(replicas int, fn Hash) *Map {
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
 		// 每个节点会添加多个虚拟节点
-		for i := 0; i < m.replicas; i++ {
-			// 生成虚拟节点的哈希值
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			// 将哈希值添加到 keys 切片
-			m.keys = append(m.keys, hash)
-			// 将哈希值映射到节点
-			m.hashMap[hash] = key
-		}
+		m.add(key, m.replicas)
 	}
 	// 对所有的哈希值进行排序
 	sort.Ints(m.keys)
 }
 
+// AddWeighted 按权重向哈希中添加一个节点，虚拟节点数为 replicas*weight，
+// 权重越大的节点分到的 key 越多
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.add(key, m.replicas*weight)
+	sort.Ints(m.keys)
+}
+
+// add 为节点添加 n 个虚拟节点，调用方负责排序
+func (m *Map) add(key string, n int) {
+	for i := 0; i < n; i++ {
+		// 生成虚拟节点的哈希值
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		// 将哈希值添加到 keys 切片
+		m.keys = append(m.keys, hash)
+		// 将哈希值映射到节点
+		m.hashMap[hash] = key
+	}
+}
+
+// Shares 返回每个节点负责的哈希空间的比例，所有比例之和为 1，
+// 用于观察 key 在节点之间的分布
+func (m *Map) Shares() map[string]float64 {
+	const space = 1 << 32 // 哈希空间的大小
+	shares := make(map[string]float64)
+	for i, hash := range m.keys {
+		// 每个虚拟节点负责从上一个虚拟节点到自己的这一段，第一个虚拟节点的这一段跨过了 0
+		prev := m.keys[len(m.keys)-1] - space
+		if i > 0 {
+			prev = m.keys[i-1]
+		}
+		shares[m.hashMap[hash]] += float64(hash-prev) / space
+	}
+	return shares
+}
+
 // Get 获取与提供的键最接近的节点
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
@@ -64,3 +95,29 @@ func (m *Map) Get(key string) string {
 	// 返回对应的节点，如果索引越界则循环使用第一个节点
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN 返回从 key 所在位置顺时针方向上遇到的至多 n 个不同节点，
+// 第一个即为 Get 返回的主节点
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+
+	// 沿哈希环遍历虚拟节点，跳过已经选中的真实节点
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,111 @@
+package geecache
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchWindow  = 2 * time.Millisecond // 默认的合并窗口
+	defaultMaxBatchSize = 100                  // 默认的单次批量加载的最大 key 数
+)
+
+// errBatchPanicked 是 BatchGetter.GetMulti panic 时同一批次中各个 key 的错误
+var errBatchPanicked = errors.New("geecache: BatchGetter.GetMulti panicked")
+
+// batchLoader 把一小段时间内本地加载的多个 key 合并为一次 BatchGetter.GetMulti 调用。
+// 同一个 key 的并发加载已经由 Group 的 singleflight 合并，这里只会看到不同的 key
+type batchLoader struct {
+	getter  BatchGetter
+	mu      sync.Mutex    // 保护以下字段
+	window  time.Duration // 第一个 key 到达后等待其他 key 的时间，为 0 时不等待
+	maxSize int           // 达到该数量时立即加载，不再等待
+	pending *pendingBatch // 正在收集 key 的批次
+}
+
+// pendingBatch 是一个等待加载的批次
+type pendingBatch struct {
+	keys   []string
+	done   chan struct{} // 加载完成后关闭
+	values map[string][]byte
+	err    error
+}
+
+func newBatchLoader(getter BatchGetter) *batchLoader {
+	return &batchLoader{getter: getter, window: defaultBatchWindow, maxSize: defaultMaxBatchSize}
+}
+
+// load 把 key 加入当前批次，等待批次加载完成后返回 key 的值
+func (b *batchLoader) load(key string) ([]byte, error) {
+	b.mu.Lock()
+	batch := b.pending
+	if batch == nil {
+		batch = &pendingBatch{done: make(chan struct{})}
+		b.pending = batch
+		if b.window > 0 {
+			time.AfterFunc(b.window, func() { b.flush(batch) })
+		}
+	}
+	batch.keys = append(batch.keys, key)
+	full := b.window <= 0 || len(batch.keys) >= b.maxSize
+	if full {
+		b.pending = nil // 之后到达的 key 进入新的批次，定时器触发时发现批次已被取走
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.run(batch)
+	}
+	<-batch.done
+	if batch.err != nil {
+		return nil, batch.err
+	}
+	value, ok := batch.values[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	return value, nil
+}
+
+// flush 在合并窗口结束时加载批次，批次已经因为达到上限被加载时什么也不做
+func (b *batchLoader) flush(batch *pendingBatch) {
+	b.mu.Lock()
+	if b.pending != batch {
+		b.mu.Unlock()
+		return
+	}
+	b.pending = nil
+	b.mu.Unlock()
+	b.run(batch)
+}
+
+// run 加载批次中的所有 key 并唤醒等待的调用方。
+// run 可能在定时器的 goroutine 中执行，GetMulti panic 时必须在这里恢复，
+// 否则会使整个进程退出，等待的调用方得到错误
+func (b *batchLoader) run(batch *pendingBatch) {
+	defer func() {
+		if r := recover(); r != nil {
+			batch.values, batch.err = nil, fmt.Errorf("%w: %v", errBatchPanicked, r)
+		}
+		close(batch.done)
+	}()
+	batch.values, batch.err = b.getter.GetMulti(batch.keys)
+}
+
+// SetBatchWindow 设置本地加载的合并窗口，只在 Getter 实现了 BatchGetter 时生效。
+// 第一个未命中的 key 到达后等待 window，期间其他未命中的 key 与它一起加载，
+// 达到 maxSize 个 key 时立即加载。window 为 0 时每个 key 单独加载
+func (g *Group) SetBatchWindow(window time.Duration, maxSize int) {
+	if g.batcher == nil {
+		return
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxBatchSize
+	}
+	g.batcher.mu.Lock()
+	defer g.batcher.mu.Unlock()
+	g.batcher.window = window
+	g.batcher.maxSize = maxSize
+}
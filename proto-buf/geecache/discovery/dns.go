@@ -0,0 +1,182 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultTimeout  = 5 * time.Second
+	defaultScheme   = "http"
+)
+
+// Resolver 是 DNS 查询接口，*net.Resolver 实现了该接口。
+// 测试时可以替换为连接本地假 DNS 服务器的 *net.Resolver。
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSConfig 是 DNS 服务发现的配置
+type DNSConfig struct {
+	Name     string               // 要解析的 DNS 名称，SRV 模式下为完整的记录名，例如 "_geecache._tcp.cache.svc"
+	SRV      bool                 // 为 true 时查询 SRV 记录，端口取自记录；否则查询 A/AAAA 记录
+	Port     int                  // A/AAAA 模式下节点的端口
+	Scheme   string               // 节点 URL 的协议，默认为 "http"
+	Interval time.Duration        // 两次解析之间的间隔
+	Timeout  time.Duration        // 单次解析的超时时间
+	Resolver Resolver             // DNS 解析器，默认为 net.DefaultResolver
+	OnChange func(peers []string) // 解析结果变化时回调，参数为排序后的节点 URL
+}
+
+// DNS 周期性地把一个 DNS 名称解析为节点 URL 列表，
+// 解析结果变化时调用 OnChange，通常用来更新 HTTPPool 的哈希环
+type DNS struct {
+	cfg  DNSConfig
+	mu   sync.Mutex // 保护 last
+	last []string   // 上一次的解析结果
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDNS 立即解析一次并开始周期性解析。
+// 首次解析失败时返回错误，之后的失败只记录日志并保留上一次的结果。
+func NewDNS(cfg DNSConfig) (*DNS, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("discovery: name is required")
+	}
+	if !cfg.SRV && cfg.Port <= 0 {
+		return nil, errors.New("discovery: port is required for A record lookups")
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = defaultScheme
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+
+	d := &DNS{cfg: cfg, done: make(chan struct{})}
+	if err := d.refresh(); err != nil {
+		return nil, err
+	}
+	d.wg.Add(1)
+	go d.loop()
+	return d, nil
+}
+
+// Peers 返回最近一次解析得到的节点 URL
+func (d *DNS) Peers() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.last...)
+}
+
+// Close 停止周期性解析
+func (d *DNS) Close() {
+	close(d.done)
+	d.wg.Wait()
+}
+
+// loop 周期性地重新解析
+func (d *DNS) loop() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.refresh(); err != nil {
+				log.Printf("[Discovery] resolving %s: %v", d.cfg.Name, err)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// refresh 解析一次，结果与上一次不同时调用 OnChange
+func (d *DNS) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+	peers, err := d.resolve(ctx)
+	if err != nil {
+		return err
+	}
+	// 空结果通常是 DNS 故障或配置错误，不应该清空哈希环
+	if len(peers) == 0 {
+		return fmt.Errorf("discovery: %s resolved to no peers", d.cfg.Name)
+	}
+
+	d.mu.Lock()
+	changed := !equal(d.last, peers)
+	d.last = peers
+	d.mu.Unlock()
+
+	if changed && d.cfg.OnChange != nil {
+		d.cfg.OnChange(peers)
+	}
+	return nil
+}
+
+// resolve 把 DNS 记录转换为排序、去重后的节点 URL
+func (d *DNS) resolve(ctx context.Context) ([]string, error) {
+	var hostports []string
+	if d.cfg.SRV {
+		_, srvs, err := d.cfg.Resolver.LookupSRV(ctx, "", "", d.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			hostports = append(hostports, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+	} else {
+		hosts, err := d.cfg.Resolver.LookupHost(ctx, d.cfg.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, host := range hosts {
+			hostports = append(hostports, net.JoinHostPort(host, strconv.Itoa(d.cfg.Port)))
+		}
+	}
+
+	seen := make(map[string]bool, len(hostports))
+	peers := make([]string, 0, len(hostports))
+	for _, hp := range hostports {
+		peer := d.cfg.Scheme + "://" + hp
+		if !seen[peer] {
+			seen[peer] = true
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	return peers, nil
+}
+
+// equal 判断两个已排序的节点列表是否相同
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDNS 是一个只支持 A 和 SRV 查询的本地 DNS 服务器
+type fakeDNS struct {
+	conn net.PacketConn
+	mu   sync.Mutex
+	a    map[string][]net.IP  // 名称 -> A 记录
+	srv  map[string][]net.SRV // 名称 -> SRV 记录
+}
+
+func newFakeDNS(t *testing.T) *fakeDNS {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeDNS{conn: conn, a: map[string][]net.IP{}, srv: map[string][]net.SRV{}}
+	go s.serve()
+	t.Cleanup(func() { conn.Close() })
+	return s
+}
+
+// setA 设置名称的 A 记录
+func (s *fakeDNS) setA(name string, ips ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.a[name] = nil
+	for _, ip := range ips {
+		s.a[name] = append(s.a[name], net.ParseIP(ip))
+	}
+}
+
+// setSRV 设置名称的 SRV 记录
+func (s *fakeDNS) setSRV(name string, srvs ...net.SRV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srv[name] = srvs
+}
+
+// resolver 返回把所有查询发往该服务器的解析器
+func (s *fakeDNS) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.conn.LocalAddr().String())
+		},
+	}
+}
+
+func (s *fakeDNS) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// answer 按照 RFC 1035 的报文格式构造应答
+func (s *fakeDNS) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	// 解析问题部分的名称
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	i++ // 跳过结尾的 0
+	qtype := binary.BigEndian.Uint16(query[i:])
+	question := query[12 : i+4]
+	name := strings.ToLower(strings.Join(labels, "."))
+
+	s.mu.Lock()
+	var rrs [][]byte
+	switch qtype {
+	case 1: // A
+		for _, ip := range s.a[name] {
+			rrs = append(rrs, rr(1, ip.To4()))
+		}
+	case 33: // SRV
+		for _, srv := range s.srv[name] {
+			data := make([]byte, 6)
+			binary.BigEndian.PutUint16(data[0:], srv.Priority)
+			binary.BigEndian.PutUint16(data[2:], srv.Weight)
+			binary.BigEndian.PutUint16(data[4:], srv.Port)
+			rrs = append(rrs, rr(33, append(data, encodeName(srv.Target)...)))
+		}
+	}
+	s.mu.Unlock()
+
+	resp := make([]byte, 12)
+	copy(resp, query[:2])                        // ID
+	binary.BigEndian.PutUint16(resp[2:], 0x8180) // 应答、期望递归、支持递归
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(rrs)))
+	resp = append(resp, question...)
+	for _, r := range rrs {
+		resp = append(resp, r...)
+	}
+	return resp
+}
+
+// rr 构造一条资源记录，名称使用指向问题部分的压缩指针
+func rr(typ uint16, data []byte) []byte {
+	b := []byte{0xc0, 0x0c, 0, 0, 0, 1, 0, 0, 0, 30, 0, 0}
+	binary.BigEndian.PutUint16(b[2:], typ)
+	binary.BigEndian.PutUint16(b[10:], uint16(len(data)))
+	return append(b, data...)
+}
+
+// encodeName 把域名编码为 DNS 报文中的标签序列
+func encodeName(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func TestDNSARecords(t *testing.T) {
+	server := newFakeDNS(t)
+	server.setA("cache.test", "10.0.0.2", "10.0.0.1")
+
+	changes := make(chan []string, 10)
+	d, err := NewDNS(DNSConfig{
+		Name:     "cache.test.",
+		Port:     8001,
+		Interval: 10 * time.Millisecond,
+		Resolver: server.resolver(),
+		OnChange: func(peers []string) { changes <- peers },
+	})
+	if err != nil {
+		t.Fatalf("NewDNS failed: %v", err)
+	}
+	defer d.Close()
+
+	expect := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001"}
+	if got := <-changes; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got %v, expect %v", got, expect)
+	}
+
+	server.setA("cache.test", "10.0.0.2", "10.0.0.1", "10.0.0.3")
+
+	expect = append(expect, "http://10.0.0.3:8001")
+	select {
+	case got := <-changes:
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("got %v, expect %v", got, expect)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no change reported after adding a record")
+	}
+}
+
+func TestDNSSRVRecords(t *testing.T) {
+	server := newFakeDNS(t)
+	server.setSRV("_geecache._tcp.cache.test",
+		net.SRV{Target: "node-b.cache.test.", Port: 8002},
+		net.SRV{Target: "node-a.cache.test.", Port: 8001},
+	)
+
+	d, err := NewDNS(DNSConfig{
+		Name:     "_geecache._tcp.cache.test.",
+		SRV:      true,
+		Resolver: server.resolver(),
+	})
+	if err != nil {
+		t.Fatalf("NewDNS failed: %v", err)
+	}
+	defer d.Close()
+
+	expect := []string{"http://node-a.cache.test:8001", "http://node-b.cache.test:8002"}
+	if got := d.Peers(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("got %v, expect %v", got, expect)
+	}
+}
@@ -0,0 +1,164 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	// ErrNotFound 表示 key 在数据源中不存在，Getter 可以返回包装了它的错误
+	ErrNotFound = errors.New("geecache: not found")
+	// ErrNoSuchGroup 表示节点上没有该 group，通常是节点之间的 group 配置不一致
+	ErrNoSuchGroup = errors.New("geecache: no such group")
+	// ErrBadRequest 表示请求本身不合法，例如 key 为空
+	ErrBadRequest = errors.New("geecache: bad request")
+	// ErrUnavailable 表示数据源暂时不可用，稍后重试可能成功
+	ErrUnavailable = errors.New("geecache: unavailable")
+	// ErrTimeout 表示加载数据超时
+	ErrTimeout = errors.New("geecache: timeout")
+)
+
+const (
+	codeInternal      = "internal"
+	protobufMediaType = "application/x-protobuf"
+)
+
+// errorKinds 是错误类型与错误码、HTTP 状态码和 gRPC 状态码的对应关系
+var errorKinds = []struct {
+	err    error
+	code   string
+	status int
+	grpc   codes.Code
+}{
+	// 没有错误详情的 404 按 ErrNoSuchGroup 处理，由请求方在本地加载。
+	// gRPC 的 NotFound 已用于 ErrNotFound，这里使用单独的状态码，错误码另外放在状态的 details 中
+	{ErrNoSuchGroup, "no_such_group", http.StatusNotFound, codes.FailedPrecondition},
+	{ErrNotFound, "not_found", http.StatusNotFound, codes.NotFound},
+	{ErrBadRequest, "bad_request", http.StatusBadRequest, codes.InvalidArgument},
+	{ErrUnavailable, "unavailable", http.StatusServiceUnavailable, codes.Unavailable},
+	{ErrTimeout, "timeout", http.StatusGatewayTimeout, codes.DeadlineExceeded},
+	{ErrUnauthenticated, "unauthenticated", http.StatusUnauthorized, codes.Unauthenticated},
+	{ErrForbidden, "forbidden", http.StatusForbidden, codes.PermissionDenied},
+}
+
+// classify 返回 err 对应的错误类型，未知错误返回 nil
+func classify(err error) error {
+	for _, k := range errorKinds {
+		if errors.Is(err, k.err) {
+			return k.err
+		}
+	}
+	var ne net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &ne) && ne.Timeout()) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// errorCode 返回 err 的错误码和 HTTP 状态码
+func errorCode(err error) (code string, status int) {
+	kind := classify(err)
+	for _, k := range errorKinds {
+		if k.err == kind {
+			return k.code, k.status
+		}
+	}
+	return codeInternal, http.StatusInternalServerError
+}
+
+// HTTPStatus 返回 err 对应的 HTTP 状态码，未知错误返回 500
+func HTTPStatus(err error) int {
+	_, status := errorCode(err)
+	return status
+}
+
+// ErrorCode 返回 err 的错误码，例如 "not_found"，未知错误返回 "internal"
+func ErrorCode(err error) string {
+	code, _ := errorCode(err)
+	return code
+}
+
+// PeerError 是远程节点返回的错误，可以用 errors.Is 判断它的类型，例如
+//
+//	errors.Is(err, geecache.ErrNotFound)
+type PeerError struct {
+	Peer       string // 远程节点的地址
+	StatusCode int    // HTTP 状态码
+	Code       string // 错误码，例如 "not_found"
+	Message    string // 远程节点给出的错误详情
+}
+
+func (e *PeerError) Error() string {
+	return fmt.Sprintf("peer %s: %s (%d): %s", e.Peer, e.Code, e.StatusCode, e.Message)
+}
+
+// Unwrap 返回错误码对应的 ErrNotFound 等错误，未知错误码返回 nil
+func (e *PeerError) Unwrap() error {
+	for _, k := range errorKinds {
+		if k.code == e.Code {
+			return k.err
+		}
+	}
+	return nil
+}
+
+// fallbackLocally 判断从远程节点获取失败后是否应该在本地加载。
+// 远程节点已经确认 key 不存在或请求不合法时，本地加载只会得到同样的结果
+func fallbackLocally(err error) bool {
+	return !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrBadRequest)
+}
+
+// writeError 按 err 的类型设置状态码，并返回错误详情。
+// 请求方接受 protobuf 时返回 pb.Error，否则返回 JSON
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, status := errorCode(err)
+	e := &pb.Error{Code: code, Message: err.Error()}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if strings.Contains(r.Header.Get("Accept"), protobufMediaType) {
+		body, _ := proto.Marshal(e)
+		w.Header().Set("Content-Type", protobufMediaType)
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+// readError 把远程节点的错误响应转换为 PeerError
+func readError(peer string, res *http.Response) *PeerError {
+	e := &PeerError{Peer: peer, StatusCode: res.StatusCode, Message: res.Status}
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4<<10))
+	msg := &pb.Error{}
+	var err error
+	if strings.HasPrefix(res.Header.Get("Content-Type"), protobufMediaType) {
+		err = proto.Unmarshal(body, msg)
+	} else {
+		err = json.Unmarshal(body, msg)
+	}
+	if err == nil && msg.GetCode() != "" {
+		e.Code, e.Message = msg.GetCode(), msg.GetMessage()
+		return e
+	}
+	// 旧版本节点或代理返回的响应没有错误详情，按状态码推断
+	e.Code = codeInternal
+	for _, k := range errorKinds {
+		if k.status == res.StatusCode {
+			e.Code = k.code
+			break
+		}
+	}
+	return e
+}
@@ -0,0 +1,101 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeHTTPStatus(t *testing.T) {
+	NewGroup("errors-remote", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "missing":
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		case "down":
+			return nil, fmt.Errorf("db is down: %w", ErrUnavailable)
+		case "slow":
+			return nil, context.DeadlineExceeded
+		case "broken":
+			return nil, errors.New("unexpected")
+		}
+		return []byte("v-" + key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://remote"))
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/_geecache/errors-remote/missing", http.StatusNotFound, "not_found"},
+		{"/_geecache/errors-remote/down", http.StatusServiceUnavailable, "unavailable"},
+		{"/_geecache/errors-remote/slow", http.StatusGatewayTimeout, "timeout"},
+		{"/_geecache/errors-remote/broken", http.StatusInternalServerError, "internal"},
+		{"/_geecache/errors-remote/", http.StatusBadRequest, "bad_request"},
+		{"/_geecache/errors-remote", http.StatusBadRequest, "bad_request"},
+		{"/_geecache/errors-nogroup/Tom", http.StatusNotFound, "no_such_group"},
+		{"/elsewhere", http.StatusNotFound, "not_found"},
+	}
+	for _, tt := range tests {
+		res, err := http.Get(server.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := &pb.Error{}
+		json.NewDecoder(res.Body).Decode(e)
+		res.Body.Close()
+		if res.StatusCode != tt.status || e.GetCode() != tt.code {
+			t.Errorf("GET %s = %d %q, want %d %q", tt.path, res.StatusCode, e.GetCode(), tt.status, tt.code)
+		}
+	}
+
+	// 节点之间使用 protobuf 错误详情，客户端得到可以判断类型的 PeerError
+	p := NewHTTPPool("http://self")
+	p.Set(server.URL)
+	peer, _ := p.PickPeer("down")
+	err := peer.Get(&pb.Request{Group: "errors-remote", Key: "down"}, &pb.Response{})
+	var pe *PeerError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrUnavailable) || pe.Peer != server.URL {
+		t.Fatalf("Get down = %v, want PeerError wrapping ErrUnavailable", err)
+	}
+	// 声明支持 not_found 的请求方得到带有标记的响应，而不是 404
+	res := &pb.Response{}
+	if err = peer.Get(&pb.Request{Group: "errors-remote", Key: "missing"}, res); err != nil || !res.GetNotFound() {
+		t.Fatalf("Get missing = %v, not_found %v, want a not_found response", err, res.GetNotFound())
+	}
+}
+
+func TestLoadFallback(t *testing.T) {
+	NewGroup("errors-owner", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return nil, ErrUnavailable
+	}))
+	server := httptest.NewServer(NewHTTPPool("http://remote"))
+	defer server.Close()
+
+	loads := make(map[string]int)
+	g := peerGroup("errors-owner", GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return []byte("local-" + key), nil
+	}))
+	p := NewHTTPPool("http://self")
+	p.Set(server.URL)
+	g.RegisterPeers(p)
+
+	// 负责的节点确认 key 不存在时，不在本地重复加载
+	if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) || loads["missing"] != 0 {
+		t.Fatalf("Get missing = %v with %d local loads, want ErrNotFound without local load", err, loads["missing"])
+	}
+	// 负责的节点暂时不可用时，在本地加载
+	if v, err := g.Get("down"); err != nil || v.String() != "local-down" {
+		t.Fatalf("Get down = %q, %v, want local value", v.String(), err)
+	}
+}
@@ -3,9 +3,12 @@ package geecache
 import (
 	pb "Cache/proto-buf/geecache/geecachepb"
 	"Cache/proto-buf/geecache/singleflight"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Group 是一个缓存命名空间和相关数据的载体
@@ -15,6 +18,14 @@ type Group struct {
 	mainCache cache               // 主缓存
 	peers     PeerPicker          // 远程节点选择器
 	loader    *singleflight.Group // 单次请求组，确保每个键值请求只会加载一次
+	batcher   *batchLoader        // Getter 实现了 BatchGetter 时合并本地加载的 key
+	codec     Codec               // 缓存中 value 的压缩格式，为 nil 时不压缩
+
+	ttl         time.Duration // 从数据源加载的 value 的有效期，为 0 时不过期
+	negativeTTL time.Duration // 不存在的 key 的缓存时间，为 0 时不缓存
+	hotQPS      float64       // 远程节点报告的 QPS 达到该值时在本地缓存，为 0 时不缓存
+	stats       *keyStats     // 其他节点请求各个 key 的 QPS
+	counters    groupCounters // 读取和加载的次数
 }
 
 // Getter 用于从外部源加载数据
@@ -40,19 +51,27 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 	if getter == nil {
 		panic("nil Getter") // 如果 Getter 为空，抛出错误
 	}
+	g := newGroup(name, cacheBytes, getter)
+
+	// 将创建的 Group 注册到全局的 groups 中
 	mu.Lock()
 	defer mu.Unlock()
+	groups[name] = g
+	return g
+}
 
-	// 创建一个新的 Group 并初始化
+// newGroup 创建并初始化 Group，但不注册到全局
+func newGroup(name string, cacheBytes int64, getter Getter) *Group {
 	g := &Group{
 		name:      name,
 		getter:    getter,
 		mainCache: cache{cacheBytes: cacheBytes}, // 初始化缓存
 		loader:    &singleflight.Group{},         // 使用 singleflight.Group 防止重复请求
+		stats:     &keyStats{},
+	}
+	if bg, ok := getter.(BatchGetter); ok {
+		g.batcher = newBatchLoader(bg)
 	}
-
-	// 将创建的 Group 注册到全局的 groups 中
-	groups[name] = g
 	return g
 }
 
@@ -64,14 +83,42 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// GroupNames 返回所有已创建的 Group 的名称，按字典序排列
+func GroupNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Name 返回 Group 的名称
+func (g *Group) Name() string {
+	return g.name
+}
+
 // Get 从缓存中获取指定键的值
 func (g *Group) Get(key string) (ByteView, error) {
+	v, err := g.lookup(key)
+	if err == nil && v.notFound {
+		return ByteView{}, notFoundError(key)
+	}
+	return v, err
+}
+
+// lookup 与 Get 相同，但缓存了的不存在的结果以 notFound 的 ByteView 返回
+func (g *Group) lookup(key string) (ByteView, error) {
 	if key == "" {
-		return ByteView{}, fmt.Errorf("key is required") // 键不能为空
+		return ByteView{}, fmt.Errorf("%w: key is required", ErrBadRequest) // 键不能为空
 	}
 
 	// 尝试从主缓存中获取数据
+	g.counters.gets.Add(1)
 	if v, ok := g.mainCache.get(key); ok {
+		g.counters.hits.Add(1)
 		log.Println("[GeeCache] hit") // 如果命中缓存，打印日志
 		return v, nil
 	}
@@ -80,6 +127,50 @@ func (g *Group) Get(key string) (ByteView, error) {
 	return g.load(key)
 }
 
+// Set 把 value 写入当前节点的缓存，ttl 大于 0 时代替 Group 的 TTL。
+// 写入只影响当前节点，其他节点上该 key 的缓存不会更新
+func (g *Group) Set(key string, value []byte, ttl time.Duration) error {
+	return g.SetWithContentType(key, value, "", ttl)
+}
+
+// SetWithContentType 与 Set 相同，同时记录 value 的媒体类型，读取时由 ByteView.ContentType 返回
+func (g *Group) SetWithContentType(key string, value []byte, contentType string, ttl time.Duration) error {
+	return g.set(key, value, ttl, func(v *ByteView) { v.contentType = contentType })
+}
+
+// SetWithFlags 与 Set 相同，同时记录客户端的标志，读取时由 ByteView.Flags 返回
+func (g *Group) SetWithFlags(key string, value []byte, flags uint32, ttl time.Duration) error {
+	return g.set(key, value, ttl, func(v *ByteView) { v.flags = flags })
+}
+
+// set 把 value 写入当前节点的缓存，meta 设置 value 的元数据
+func (g *Group) set(key string, value []byte, ttl time.Duration, meta func(*ByteView)) error {
+	if key == "" {
+		return fmt.Errorf("%w: key is required", ErrBadRequest)
+	}
+	v := g.newView(value)
+	meta(&v)
+	if ttl > 0 {
+		v.expire = time.Now().Add(ttl)
+	}
+	g.populateCache(key, v)
+	return nil
+}
+
+// Remove 从当前节点的缓存中删除 key，返回 key 之前是否在缓存中
+func (g *Group) Remove(key string) bool {
+	return g.mainCache.remove(key)
+}
+
+// Touch 修改当前节点缓存中 key 的过期时间，ttl 为 0 时不过期，返回 key 是否在缓存中
+func (g *Group) Touch(key string, ttl time.Duration) bool {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	return g.mainCache.touch(key, expire)
+}
+
 // RegisterPeers 注册远程节点选择器
 func (g *Group) RegisterPeers(peers PeerPicker) {
 	if g.peers != nil {
@@ -93,6 +184,7 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	// 使用 singleflight.Group 确保每个键只会请求一次
 	viewi, err := g.loader.Do(key, func() (interface{}, error) {
 		// 如果有远程节点，尝试从远程节点获取数据
+		var failed PeerGetter // 已经请求失败的节点
 		if g.peers != nil {
 			if peer, ok := g.peers.PickPeer(key); ok {
 				// 尝试从远程 peer 获取数据
@@ -100,6 +192,22 @@ func (g *Group) load(key string) (value ByteView, err error) {
 					return value, nil
 				}
 				log.Println("[GeeCache] Failed to get from peer", err)
+				// 负责该 key 的节点已经给出了确定的结果，本地加载也不会不同
+				if !fallbackLocally(err) {
+					return nil, err
+				}
+				failed = peer
+			}
+		}
+
+		// 哈希环刚发生变化时，先向之前负责该 key 的节点要数据，避免新节点冷启动时集中回源。
+		// 之前负责的节点就是刚刚失败的节点时不再重复请求
+		if picker, ok := g.peers.(PreviousPeerPicker); ok {
+			if peer, ok := picker.PickPreviousPeer(key); ok && !samePeer(peer, failed) {
+				if value, err = g.getFromPeer(peer, key); err == nil {
+					g.populateCache(key, value)
+					return value, nil
+				}
 			}
 		}
 
@@ -114,20 +222,33 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
-// populateCache 将数据添加到缓存中
+// populateCache 将数据添加到缓存中，设置了压缩格式时以压缩后的形式存放
 func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+	g.mainCache.add(key, g.compress(value))
 }
 
 // getLocally 从本地加载数据
 func (g *Group) getLocally(key string) (ByteView, error) {
-	// 使用 getter 从外部源获取数据
-	bytes, err := g.getter.Get(key)
+	// 使用 getter 从外部源获取数据，支持批量加载时与其他 key 合并为一次查询
+	var bytes []byte
+	var err error
+	g.counters.localLoads.Add(1)
+	if g.batcher != nil {
+		bytes, err = g.batcher.load(key)
+	} else {
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
+		// 缓存不存在的结果，避免不存在的 key 反复穿透到数据源
+		if g.negativeTTL > 0 && errors.Is(err, ErrNotFound) {
+			marker := ByteView{notFound: true, expire: time.Now().Add(g.negativeTTL)}
+			g.populateCache(key, marker)
+			return marker, nil
+		}
 		return ByteView{}, err
 	}
 	// 将获取的数据封装成 ByteView 并缓存
-	value := ByteView{b: cloneBytes(bytes)}
+	value := g.newView(bytes)
 	g.populateCache(key, value)
 	return value, nil
 }
@@ -135,8 +256,9 @@ func (g *Group) getLocally(key string) (ByteView, error) {
 // getFromPeer 从远程节点获取数据
 func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:     g.name,
+		Key:       key,
+		RequestId: newRequestID(),
 	}
 	res := &pb.Response{}
 	// 通过 peer 调用远程接口获取数据
@@ -144,5 +266,17 @@ func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	if id := res.GetRequestId(); id != "" && id != req.RequestId {
+		return ByteView{}, fmt.Errorf("response for request %s, want %s", id, req.RequestId)
+	}
+	value, err := viewFromResponse(res)
+	if err != nil {
+		return ByteView{}, err
+	}
+	g.counters.peerLoads.Add(1)
+	// 热点 key 在本地也缓存一份，分摊负责节点的压力。没有过期时间的不存在结果不缓存
+	if g.hotQPS > 0 && res.GetMinuteQps() >= g.hotQPS && (!value.notFound || !value.expire.IsZero()) {
+		g.populateCache(key, value)
+	}
+	return value, nil
 }
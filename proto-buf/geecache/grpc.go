@@ -0,0 +1,424 @@
+package geecache
+
+import (
+	"Cache/proto-buf/geecache/consistenthash"
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const defaultGRPCTimeout = 3 * time.Second // 默认的单次请求超时时间
+
+// GRPCPool 实现了 PeerPicker 接口，通过 gRPC 的 GroupCache 服务与其他节点通信，
+// 可以替代 HTTPPool 使用。同时它也是 GroupCache 服务的服务端实现。
+type GRPCPool struct {
+	pb.UnimplementedGroupCacheServer
+
+	self            string              // 当前节点的地址，例如 "localhost:8001"
+	timeout         time.Duration       // 单次请求的超时时间
+	streamThreshold int                 // GetStream 中不超过该大小的 value 只发送一块
+	maxStreamBytes  int64               // GetStream 接收的 value 的最大长度
+	dialOpts        []grpc.DialOption   // 连接其他节点时使用的选项
+	mu              sync.Mutex          // 用于保护以下字段的锁
+	auth            Authenticator       // 不为 nil 时要求请求通过认证
+	acl             *ACL                // 按 group 控制访问权限
+	signer          Signer              // 不为 nil 时为发往其他节点的请求签名
+	peers           *consistenthash.Map // 哈希环，用于根据 key 选择节点
+	getters         map[string]*grpcGetter
+}
+
+// NewGRPCPool 初始化一个 gRPC 节点池，默认使用不加密的连接
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GRPCPool{
+		self:            self,
+		timeout:         defaultGRPCTimeout,
+		streamThreshold: defaultStreamThreshold,
+		maxStreamBytes:  defaultMaxResponseBytes,
+		dialOpts:        opts,
+		getters:         make(map[string]*grpcGetter),
+	}
+}
+
+// Log 用于打印带有服务器名称的日志信息
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[gRPC Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// SetTimeout 设置向其他节点请求时的超时时间
+func (p *GRPCPool) SetTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeout = d
+}
+
+// SetMaxResponseSize 限制通过 GetStream 从其他节点读取的 value 大小，超过时请求失败。
+// 单次调用的消息大小由 gRPC 的 MaxCallRecvMsgSize 限制
+func (p *GRPCPool) SetMaxResponseSize(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.maxStreamBytes = n
+}
+
+// SetAuth 要求其他节点的请求通过 auth 认证，并按 acl 检查 group 的访问权限。
+// 检查由 ServerOptions 返回的拦截器完成，创建 gRPC 服务器时必须使用这些选项
+func (p *GRPCPool) SetAuth(auth Authenticator, acl *ACL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.auth, p.acl = auth, acl
+}
+
+// SetSigner 为发往其他节点的请求签名，通常与其他节点的 SetAuth 配合使用
+func (p *GRPCPool) SetSigner(s Signer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signer = s
+}
+
+// ServerOptions 返回创建 gRPC 服务器时使用的选项，其中的拦截器按 SetAuth 的配置认证和授权
+func (p *GRPCPool) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(p.authUnary),
+		grpc.ChainStreamInterceptor(p.authStream),
+	}
+}
+
+// Register 在 gRPC 服务器上注册 GroupCache 服务
+func (p *GRPCPool) Register(s *grpc.Server) {
+	pb.RegisterGroupCacheServer(s, p)
+}
+
+// Set 更新节点池中的节点列表。仍在列表中的节点复用已有的连接，被移除的节点的连接会被关闭
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := p.getters[peer]; ok {
+			getters[peer] = g
+			continue
+		}
+		if peer == p.self {
+			continue
+		}
+		// passthrough 保持 grpc.Dial 的行为：直接连接给定的地址，不做名称解析和负载均衡
+		conn, err := grpc.NewClient("passthrough:///"+peer, p.dialOpts...)
+		if err != nil {
+			return err
+		}
+		getters[peer] = &grpcGetter{peer: peer, conn: conn, client: pb.NewGroupCacheClient(conn), pool: p}
+	}
+	for peer, g := range p.getters {
+		if _, ok := getters[peer]; !ok {
+			g.conn.Close()
+		}
+	}
+
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.getters = getters
+	return nil
+}
+
+// PickPeer 根据 key 选择一个远程节点
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// Getter 返回节点 peer 的 PeerGetter，peer 不在节点列表中或是当前节点时返回 false
+func (p *GRPCPool) Getter(peer string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.getters[peer]
+	if !ok {
+		return nil, false
+	}
+	return g, true
+}
+
+// Close 关闭与所有节点的连接
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for peer, g := range p.getters {
+		if cerr := g.conn.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(p.getters, peer)
+	}
+	return err
+}
+
+// Get 实现了 GroupCache 服务，处理其他节点的请求
+func (p *GRPCPool) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	p.Log("Get %s/%s [%s]", in.GetGroup(), in.GetKey(), in.GetRequestId())
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, grpcError(fmt.Errorf("%w: %s", ErrNoSuchGroup, in.GetGroup()))
+	}
+	view, err := peerLookup(group, in.GetKey(), false, incomingAcceptNotFound(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	res := &pb.Response{MinuteQps: group.stats.hit(in.GetKey()), RequestId: in.GetRequestId()}
+	if err := fillResponse(res, view, incomingAccept(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	return res, nil
+}
+
+// GetMulti 实现了 GroupCache 服务，处理其他节点的批量请求
+func (p *GRPCPool) GetMulti(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	p.Log("GetMulti %s: %d keys", in.GetGroup(), len(in.GetKeys()))
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, grpcError(fmt.Errorf("%w: %s", ErrNoSuchGroup, in.GetGroup()))
+	}
+	return batchResponse(group, in.GetKeys(), incomingAccept(ctx)), nil
+}
+
+// grpcGetter 实现了 PeerGetter 接口，通过 gRPC 从远程节点获取数据
+type grpcGetter struct {
+	peer   string              // 远程节点的地址
+	conn   *grpc.ClientConn    // 与远程节点的连接，由所有请求复用
+	client pb.GroupCacheClient // GroupCache 服务的客户端
+	pool   *GRPCPool           // 所属的节点池，提供请求的超时时间
+}
+
+// Get 从远程节点获取数据
+func (g *grpcGetter) Get(in *pb.Request, out *pb.Response) error {
+	g.pool.mu.Lock()
+	timeout, limit := g.pool.timeout, g.pool.maxStreamBytes
+	g.pool.mu.Unlock()
+
+	// 每个请求都带有截止时间，避免一个慢节点拖住所有加载
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 优先使用 GetStream，大 value 不受单条消息大小的限制
+	streamCtx, err := g.pool.outgoingContext(ctx, pb.GroupCache_GetStream_FullMethodName)
+	if err != nil {
+		return err
+	}
+	stream, err := g.client.GetStream(streamCtx, in)
+	if err != nil {
+		return grpcPeerError(g.peer, err)
+	}
+	res, err := recvStream(stream, limit)
+	if err == nil {
+		res.RequestId = in.GetRequestId()
+		out.Reset()
+		proto.Merge(out, res)
+		return nil
+	}
+	if err != errStreamUnsupported {
+		return grpcPeerError(g.peer, err)
+	}
+
+	if ctx, err = g.pool.outgoingContext(ctx, pb.GroupCache_Get_FullMethodName); err != nil {
+		return err
+	}
+	res, err = g.client.Get(ctx, in)
+	if err != nil {
+		return grpcPeerError(g.peer, err)
+	}
+	out.Reset()
+	proto.Merge(out, res)
+	return nil
+}
+
+// GetMulti 通过一次 gRPC 调用从远程节点获取多个 key
+func (g *grpcGetter) GetMulti(in *pb.BatchRequest, out *pb.BatchResponse) error {
+	g.pool.mu.Lock()
+	timeout := g.pool.timeout
+	g.pool.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx, err := g.pool.outgoingContext(ctx, pb.GroupCache_GetMulti_FullMethodName)
+	if err != nil {
+		return err
+	}
+	res, err := g.client.GetMulti(ctx, in)
+	if err != nil {
+		return grpcPeerError(g.peer, err)
+	}
+	out.Reset()
+	proto.Merge(out, res)
+	return nil
+}
+
+// String 返回节点的地址
+func (g *grpcGetter) String() string {
+	return g.peer
+}
+
+// Addr 实现了 PeerAddresser 接口
+func (g *grpcGetter) Addr() string {
+	return g.peer
+}
+
+// outgoingContext 返回带有当前节点能够处理的压缩格式和 not_found 响应的 context，
+// 配置了 signer 时还带有对 method 的签名
+func (p *GRPCPool) outgoingContext(ctx context.Context, method string) (context.Context, error) {
+	kv := []string{
+		strings.ToLower(acceptEncodingHeader), acceptedEncodings(),
+		strings.ToLower(acceptNotFoundHeader), "1",
+	}
+	p.mu.Lock()
+	signer := p.signer
+	p.mu.Unlock()
+	if signer != nil {
+		r := rpcRequest(method, nil)
+		if err := signer.Sign(r); err != nil {
+			return nil, err
+		}
+		for k := range r.Header {
+			kv = append(kv, strings.ToLower(k), r.Header.Get(k))
+		}
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...), nil
+}
+
+// authorize 认证 gRPC 调用并检查调用方能否访问请求中的 group
+func (p *GRPCPool) authorize(ctx context.Context, method string, req interface{}) error {
+	p.mu.Lock()
+	auth, acl := p.auth, p.acl
+	p.mu.Unlock()
+	if auth == nil {
+		return nil
+	}
+	var group string
+	if g, ok := req.(interface{ GetGroup() string }); ok {
+		group = g.GetGroup()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if _, err := Authorize(auth, acl, rpcRequest(method, md), group); err != nil {
+		return grpcError(err)
+	}
+	return nil
+}
+
+// authUnary 是认证一元调用的拦截器
+func (p *GRPCPool) authUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := p.authorize(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream 是认证流式调用的拦截器，在收到请求消息后才能知道要访问的 group
+func (p *GRPCPool) authStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &authServerStream{ServerStream: ss, pool: p, method: info.FullMethod})
+}
+
+// authServerStream 在每次收到请求消息后认证和授权
+type authServerStream struct {
+	grpc.ServerStream
+	pool   *GRPCPool
+	method string
+}
+
+// RecvMsg 接收请求消息并检查访问权限
+func (s *authServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.pool.authorize(s.Context(), s.method, m)
+}
+
+// incomingAccept 返回请求方能够解压的格式
+func incomingAccept(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return strings.Join(md.Get(acceptEncodingHeader), ",")
+}
+
+// incomingAcceptNotFound 判断请求方能否处理 not_found 响应
+func incomingAcceptNotFound(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get(acceptNotFoundHeader)) > 0
+}
+
+// grpcCode 返回 err 对应的 gRPC 状态码
+func grpcCode(err error) codes.Code {
+	kind := classify(err)
+	for _, k := range errorKinds {
+		if k.err == kind {
+			return k.grpc
+		}
+	}
+	return codes.Internal
+}
+
+// grpcError 把 err 转换为 gRPC 状态，错误码同时以 pb.Error 放在状态的 details 中，
+// 请求方据此还原错误类型，不依赖 gRPC 状态码与错误类型的对应关系
+func grpcError(err error) error {
+	code, _ := errorCode(err)
+	st := status.New(grpcCode(err), err.Error())
+	if detailed, derr := st.WithDetails(&pb.Error{Code: code, Message: err.Error()}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// grpcErrorDetail 返回状态中由 grpcError 附加的 pb.Error，没有时返回 nil
+func grpcErrorDetail(st *status.Status) *pb.Error {
+	for _, d := range st.Details() {
+		if e, ok := d.(*pb.Error); ok {
+			return e
+		}
+	}
+	return nil
+}
+
+// grpcPeerError 把远程节点返回的 gRPC 状态转换为 PeerError，连接层面的错误原样返回
+func grpcPeerError(peer string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	if e := grpcErrorDetail(st); e != nil {
+		return peerResultError(peer, e)
+	}
+	e := &PeerError{Peer: peer, StatusCode: http.StatusInternalServerError, Code: codeInternal, Message: st.Message()}
+	for _, k := range errorKinds {
+		if k.grpc == st.Code() {
+			e.StatusCode, e.Code = k.status, k.code
+			break
+		}
+	}
+	return e
+}
+
+// 确保 GRPCPool 实现了 PeerPicker 接口，grpcGetter 实现了 PeerGetter 和 PeerAddresser 接口
+var (
+	_ PeerPicker          = (*GRPCPool)(nil)
+	_ PeerGetter          = (*grpcGetter)(nil)
+	_ PeerAddresser       = (*grpcGetter)(nil)
+	_ pb.GroupCacheServer = (*GRPCPool)(nil)
+)
@@ -0,0 +1,129 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCPool(t *testing.T) {
+	g := NewGroup("grpc-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		return []byte("v-" + key), nil
+	}))
+
+	// 服务端节点监听在内存中的 bufconn 上
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	NewGRPCPool("remote").Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	dials := 0
+	p := NewGRPCPool("self",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			dials++
+			return lis.DialContext(ctx)
+		}))
+	defer p.Close()
+	p.SetTimeout(100 * time.Millisecond)
+	if err := p.Set("remote"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	for _, key := range []string{"Tom", "Jack", "Tom"} {
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatalf("PickPeer(%s) should pick the remote node", key)
+		}
+		v, err := g.getFromPeer(peer, key)
+		if err != nil || v.String() != "v-"+key {
+			t.Fatalf("getFromPeer(%s) = %q, %v", key, v, err)
+		}
+	}
+	if dials != 1 {
+		t.Errorf("expect the connection to be reused, dialed %d times", dials)
+	}
+
+	// 超过截止时间的请求返回错误，由调用方回退到本地加载
+	peer, _ := p.PickPeer("slow")
+	if _, err := g.getFromPeer(peer, "slow"); err == nil {
+		t.Errorf("expect deadline exceeded for slow key")
+	}
+
+	// 节点列表不变时复用原有连接
+	if err := p.Set("remote", "self"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got := p.getters["remote"]; got == nil {
+		t.Fatalf("remote getter lost after Set")
+	}
+}
+
+// bearerSigner 在请求中附加 API token
+type bearerSigner string
+
+func (s bearerSigner) Sign(r *http.Request) error {
+	r.Header.Set("Authorization", "Bearer "+string(s))
+	return nil
+}
+
+func TestGRPCPoolAuth(t *testing.T) {
+	g := NewGroup("grpc-auth", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	peerAuth := NewHMACAuth([]byte("cluster-key"))
+	acl := NewACL()
+	acl.Allow("grpc-auth", "alice")
+
+	lis := bufconn.Listen(1 << 20)
+	remote := NewGRPCPool("remote")
+	remote.SetAuth(MultiAuth{peerAuth, TokenAuth{"alice-token": "alice", "bob-token": "bob", "peer-token": PeerPrincipal}}, acl)
+	server := grpc.NewServer(remote.ServerOptions()...)
+	remote.Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	get := func(signer Signer) error {
+		p := NewGRPCPool("self",
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}))
+		defer p.Close()
+		if signer != nil {
+			p.SetSigner(signer)
+		}
+		p.Set("remote")
+		peer, _ := p.PickPeer("Tom")
+		_, err := g.getFromPeer(peer, "Tom")
+		return err
+	}
+	tests := []struct {
+		name   string
+		signer Signer
+		want   error
+	}{
+		{"peer", peerAuth, nil},
+		{"alice", bearerSigner("alice-token"), nil},
+		{"bob", bearerSigner("bob-token"), ErrForbidden},
+		{"token mapped to the peer principal", bearerSigner("peer-token"), ErrUnauthenticated},
+		{"wrong key", NewHMACAuth([]byte("other")), ErrUnauthenticated},
+		{"anonymous", nil, ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		if err := get(tt.signer); (tt.want == nil && err != nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: getFromPeer error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
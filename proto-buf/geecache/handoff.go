@@ -0,0 +1,182 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// handoffWorkers 是下线时并发推送条目的数量
+const handoffWorkers = 8
+
+// handoffTask 是一个待推送的条目
+type handoffTask struct {
+	group  string
+	entry  entry
+	owner  string
+	getter *httpGetter
+}
+
+// Drain 让当前节点进入下线流程：把自己从哈希环中移除，
+// 然后把注册了当前节点池的每个 Group 中最热的至多 limit 个条目推送给按新哈希环计算出的负责节点，
+// 使它们在接管流量前就已经缓存了热点数据。条目按其他节点请求的 QPS 排序，QPS 相同时按最近访问排序。
+// 推送并发进行，ctx 结束时放弃剩余的条目。返回成功推送的条目数。
+// 接收方只接受节点签名的推送，没有通过 WithSigner 配置签名时只移出哈希环，不推送。
+// 下线过程中当前节点仍然响应请求，但只从本地读取。
+func (p *HTTPPool) Drain(ctx context.Context, limit int) (pushed int, err error) {
+	p.mu.Lock()
+	p.draining = true
+	p.rebuildLocked()
+	p.mu.Unlock()
+
+	if limit <= 0 {
+		return 0, nil
+	}
+	if p.signer == nil {
+		p.Log("handoff skipped: peer signing is not configured")
+		return 0, nil
+	}
+
+	mu.RLock()
+	var all []*Group
+	for _, g := range groups {
+		if g.peers == PeerPicker(p) {
+			all = append(all, g)
+		}
+	}
+	mu.RUnlock()
+
+	var tasks []handoffTask
+	for _, g := range all {
+		for _, e := range g.mainCache.hottest(limit, g.stats.qps) {
+			p.mu.Lock()
+			owner := p.peers.Get(e.key)
+			getter := p.httpGetters[owner]
+			p.mu.Unlock()
+			if getter == nil {
+				continue // 没有其他节点可以接管
+			}
+			tasks = append(tasks, handoffTask{group: g.name, entry: e, owner: owner, getter: getter})
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		resMu   sync.Mutex
+		failed  int
+		skipped int
+		next    = make(chan handoffTask)
+	)
+	for i := 0; i < handoffWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range next {
+				err := t.getter.push(ctx, t.group, t.entry.key, t.entry.value)
+				resMu.Lock()
+				if err != nil {
+					p.Log("handoff %s/%s to %s failed: %v", t.group, t.entry.key, t.owner, err)
+					failed++
+				} else {
+					pushed++
+				}
+				resMu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i, t := range tasks {
+		// 两个分支都就绪时 select 随机选择，因此先检查 ctx
+		if ctx.Err() != nil {
+			skipped = len(tasks) - i
+			break
+		}
+		select {
+		case next <- t:
+		case <-ctx.Done():
+			skipped = len(tasks) - i // 超过期限，放弃剩余的条目
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	p.Log("handoff finished: %d entries pushed, %d failed, %d skipped", pushed, failed, skipped)
+	if failed > 0 || skipped > 0 {
+		return pushed, fmt.Errorf("handoff: %d entries failed, %d skipped", failed, skipped)
+	}
+	return pushed, nil
+}
+
+// receiveHandoff 把其他节点推送过来的条目加入缓存
+func (p *HTTPPool) receiveHandoff(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	// 多读一个字节用于判断是否超过上限
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, p.maxResponseBytes+1))
+	if err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	if int64(len(body)) > p.maxResponseBytes {
+		writeError(w, r, fmt.Errorf("%w: request body exceeds %d bytes", ErrBadRequest, p.maxResponseBytes))
+		return
+	}
+	res := &pb.Response{}
+	if err = proto.Unmarshal(body, res); err != nil {
+		writeError(w, r, fmt.Errorf("%w: decoding request body: %v", ErrBadRequest, err))
+		return
+	}
+	view, err := viewFromResponse(res)
+	if err != nil {
+		writeError(w, r, fmt.Errorf("%w: %v", ErrBadRequest, err))
+		return
+	}
+	group.populateCache(key, view)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// push 把一个条目推送给远程节点。旧版本的节点不认识压缩格式，因此发送解压后的数据
+func (h *httpGetter) push(ctx context.Context, group, key string, view ByteView) error {
+	value, err := view.Bytes()
+	if err != nil {
+		return err
+	}
+	body, err := proto.Marshal(&pb.Response{
+		Value:       value,
+		Expire:      unixMilli(view.expire),
+		Version:     view.version,
+		ContentType: view.contentType,
+		Flags:       view.flags,
+	})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf(
+		"%v%v/%v",
+		h.baseURL,
+		url.QueryEscape(group),
+		url.QueryEscape(key),
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", protobufMediaType)
+	res, err := h.pool.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent {
+		return readError(h.peer, res)
+	}
+	return nil
+}
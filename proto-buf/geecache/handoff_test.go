@@ -0,0 +1,126 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestDrainPushesHotEntries(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		res := &pb.Response{}
+		if r.Method != http.MethodPut || proto.Unmarshal(body, res) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[r.URL.Path] = string(res.Value)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	})
+	g := NewGroup("handoff", 2<<10, getter)
+	for _, key := range []string{"a", "b", "c"} {
+		g.Get(key)
+	}
+	g.Get("a") // a 最近被访问，QPS 相同时排在 c 前面
+	for i := 0; i < 3; i++ {
+		g.stats.hit("b") // b 被其他节点请求得最多，应该最先被推送
+	}
+	g.mainCache.add("old", ByteView{b: []byte("v-old"), expire: time.Now().Add(-time.Second)})
+	g.stats.hit("old") // 已经过期的条目不推送
+
+	// 没有配置签名时接收方会拒绝推送，Drain 只移出哈希环
+	self := "http://self"
+	unsigned := NewHTTPPool(self)
+	unsigned.Set(self, server.URL)
+	if n, err := unsigned.Drain(context.Background(), 2); n != 0 || err != nil {
+		t.Errorf("Drain without signer = %d, %v, want no entries pushed", n, err)
+	}
+	if len(received) != 0 {
+		t.Errorf("Drain without signer pushed %v", received)
+	}
+
+	p := NewHTTPPool(self, WithSigner(NewHMACAuth([]byte("cluster-key"))))
+	p.Set(self, server.URL)
+	g.RegisterPeers(p)
+	// 没有注册当前节点池的 Group 不推送
+	other := NewGroup("handoff-other", 2<<10, getter)
+	other.Get("x")
+
+	n, err := p.Drain(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expect := map[string]string{
+		defaultBasePath + "handoff/b": "v-b",
+		defaultBasePath + "handoff/a": "v-a",
+	}
+	if n != len(expect) || len(received) != len(expect) {
+		t.Errorf("pushed %d entries %v, want %v", n, received, expect)
+	}
+	for path, v := range expect {
+		if received[path] != v {
+			t.Errorf("handoff %s got %q, expect %q", path, received[path], v)
+		}
+	}
+
+	if _, ok := p.PickPeer("a"); ok {
+		t.Errorf("draining pool should serve locally")
+	}
+
+	// 超过期限后不再推送
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if n, err := p.Drain(ctx, 2); n != 0 || err == nil {
+		t.Errorf("Drain after the deadline = %d, %v, want the entries skipped", n, err)
+	}
+}
+
+func TestReceiveHandoff(t *testing.T) {
+	g := NewGroup("handoff-recv", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("from source"), nil
+	}))
+	peerAuth := NewHMACAuth([]byte("cluster-key"))
+	push := func(receiver *HTTPPool, sender *HTTPPool, value string) error {
+		server := httptest.NewServer(receiver)
+		defer server.Close()
+		sender.Set("http://self", server.URL)
+		getter, _ := sender.Getter(server.URL)
+		return getter.(*httpGetter).push(context.Background(), g.name, "k", ByteView{b: []byte(value)})
+	}
+
+	// 没有配置节点认证时无法确认推送方是集群中的节点
+	if err := push(NewHTTPPool("http://remote"), NewHTTPPool("http://self"), "v"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("push without peer auth: %v, want ErrForbidden", err)
+	}
+	receiver := NewHTTPPool("http://remote", WithAuth(peerAuth, nil), WithMaxResponseSize(16))
+	sender := NewHTTPPool("http://self", WithSigner(peerAuth))
+	if err := push(receiver, sender, strings.Repeat("x", 32)); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("push of oversized entry: %v, want ErrBadRequest", err)
+	}
+	if err := push(receiver, sender, "v"); err != nil {
+		t.Fatalf("push failed: %v", err)
+	}
+	if v, err := g.Get("k"); err != nil || v.String() != "v" {
+		t.Errorf("Get(k) = %q, %v, want the pushed value", v.String(), err)
+	}
+}
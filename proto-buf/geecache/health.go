@@ -0,0 +1,124 @@
+package geecache
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	healthPath            = "health"    // 健康检查路径，位于 basePath 之下
+	defaultEjectAfter     = 3           // 连续失败多少次后将节点弹出哈希环
+	defaultReinstateAfter = 2           // 弹出后连续成功多少次健康检查才恢复
+	defaultHealthTimeout  = time.Second // 单次健康检查的超时时间
+)
+
+// peerHealth 记录一个节点的健康状况
+type peerHealth struct {
+	failures  int  // 连续失败次数
+	successes int  // 被弹出后连续成功的健康检查次数
+	ejected   bool // 是否已从哈希环中弹出
+}
+
+// observe 记录一次对 peer 的请求或健康检查结果。
+// 连续失败达到阈值时将节点从哈希环中弹出，它负责的 key 会临时交给其他节点；
+// 被弹出的节点连续通过健康检查后重新加入哈希环。
+func (p *HTTPPool) observe(peer string, ok bool) {
+	if p == nil || peer == p.self {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, exists := p.health[peer]
+	if !exists {
+		return // 节点已经不在列表中
+	}
+
+	if !ok {
+		h.successes = 0
+		h.failures++
+		if !h.ejected && h.failures >= defaultEjectAfter {
+			h.ejected = true
+			p.rebuildLocked()
+			p.Log("peer %s ejected after %d consecutive failures", peer, h.failures)
+		}
+		return
+	}
+
+	h.failures = 0
+	if h.ejected {
+		h.successes++
+		if h.successes >= defaultReinstateAfter {
+			h.ejected = false
+			h.successes = 0
+			p.rebuildLocked()
+			p.Log("peer %s reinstated", peer)
+		}
+	}
+}
+
+// Ejected 返回当前被弹出哈希环的节点
+func (p *HTTPPool) Ejected() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ejected []string
+	for peer, h := range p.health {
+		if h.ejected {
+			ejected = append(ejected, peer)
+		}
+	}
+	sort.Strings(ejected)
+	return ejected
+}
+
+// StartHealthCheck 周期性地请求每个远程节点的健康检查接口，
+// 结果与正常请求的结果一起用于弹出和恢复节点。返回的 stop 函数用于停止检查。
+func (p *HTTPPool) StartHealthCheck(interval time.Duration) (stop func()) {
+	timeout := defaultHealthTimeout
+	if interval < timeout {
+		timeout = interval
+	}
+	// 复用节点池的连接，但使用更短的超时时间
+	client := &http.Client{Transport: p.client.Transport, Timeout: timeout}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.checkPeers(client)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// checkPeers 并发地检查所有远程节点
+func (p *HTTPPool) checkPeers(client *http.Client) {
+	p.mu.Lock()
+	var peers []string
+	for peer := range p.health {
+		if peer != p.self {
+			peers = append(peers, peer)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			res, err := client.Get(peer + p.basePath + healthPath)
+			if err == nil {
+				res.Body.Close()
+			}
+			p.observe(peer, err == nil && res.StatusCode == http.StatusOK)
+		}(peer)
+	}
+	wg.Wait()
+}
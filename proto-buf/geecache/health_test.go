@@ -0,0 +1,53 @@
+package geecache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheckEjectsAndReinstates(t *testing.T) {
+	var down atomic.Bool
+	remote := NewHTTPPool("http://remote")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		remote.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	self := "http://self"
+	p := NewHTTPPool(self)
+	p.Set(self, server.URL)
+	stop := p.StartHealthCheck(10 * time.Millisecond)
+	defer stop()
+
+	waitEjected := func(expect []string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if got := p.Ejected(); reflect.DeepEqual(got, expect) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Ejected() = %v, expect %v", p.Ejected(), expect)
+	}
+
+	down.Store(true)
+	waitEjected([]string{server.URL})
+	// 被弹出后所有 key 都由当前节点负责
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if _, ok := p.PickPeer(key); ok {
+			t.Errorf("PickPeer(%s) picked an ejected peer", key)
+		}
+	}
+
+	down.Store(false)
+	waitEjected(nil)
+}
@@ -3,20 +3,25 @@ package geecache
 import (
 	"Cache/proto-buf/geecache/consistenthash"
 	pb "Cache/proto-buf/geecache/geecachepb"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 )
 
 const (
-	defaultBasePath = "/_geecache/" // 默认的基础路径
-	defaultReplicas = 50            // 默认的副本数
+	defaultBasePath       = "/_geecache/" // 默认的基础路径
+	defaultReplicas       = 50            // 默认的副本数
+	defaultReplicaSetSize = 1             // 默认每个 key 的副本集合大小
 )
 
 // HTTPPool 实现了 PeerPicker 接口，用于处理 HTTP 请求的节点池。
@@ -26,14 +31,52 @@ type HTTPPool struct {
 	mu          sync.Mutex             // 用于保护 peers 和 httpGetters 的锁
 	peers       *consistenthash.Map    // 哈希环，用于根据 key 选择节点
 	httpGetters map[string]*httpGetter // 存储节点的 httpGetter，按节点 URL 索引
+	topology    map[string]Topology    // 节点的拓扑标签，按节点 URL 索引
+	replicaSet  int                    // 每个 key 的副本集合大小
+	members     []Peer                 // 配置的全部节点，哈希环由其中未被弹出的节点构成
+	health      map[string]*peerHealth // 节点的健康状况，按节点 URL 索引
+	draining    bool                   // 是否正在下线，下线时当前节点不再出现在哈希环上
+	grace       time.Duration          // 节点列表变化后的过渡期，为 0 时不启用
+	prev        *consistenthash.Map    // 节点列表变化前的哈希环
+	prevPeekers map[string]*httpGetter // 变化前各节点的只读缓存 httpGetter，按节点 URL 索引
+	prevUntil   time.Time              // 过渡期的结束时间
+	peerFile    []byte                 // 最近一次应用的节点列表配置文件的内容
+
+	client           *http.Client      // 向其他节点发送请求的客户端，所有节点共用连接池
+	transport        http.RoundTripper // 自定义的 RoundTripper
+	timeout          time.Duration     // 单次请求的超时时间
+	maxIdleConns     int               // 每个节点保留的最大空闲连接数
+	maxConns         int               // 每个节点的最大连接数
+	maxResponseBytes int64             // 最大响应体大小
+	tlsConfig        *tls.Config       // 访问其他节点时使用的 TLS 配置
+	streamThreshold  int               // 超过该大小的 value 分块传输
+
+	auth   Authenticator // 校验访问当前节点的请求，为 nil 时不做认证
+	acl    *ACL          // 各 group 允许访问的身份，为 nil 时不限制
+	signer Signer        // 为发往其他节点的请求签名，为 nil 时不签名
 }
 
 // NewHTTPPool 初始化一个 HTTP 节点池
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
+		self:             self,
+		basePath:         defaultBasePath,
+		replicaSet:       defaultReplicaSetSize,
+		timeout:          defaultTimeout,
+		maxIdleConns:     defaultMaxIdleConns,
+		maxResponseBytes: defaultMaxResponseBytes,
+		streamThreshold:  defaultStreamThreshold,
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	p.client = p.newClient()
+	return p
+}
+
+// Self 返回当前节点的 URL
+func (p *HTTPPool) Self() string {
+	return p.self
 }
 
 // Log 用于打印带有服务器名称的日志信息
@@ -45,38 +88,88 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// 检查请求路径是否以 basePath 开头
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		writeError(w, r, fmt.Errorf("%w: unexpected path %s", ErrNotFound, r.URL.Path))
+		return
+	}
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID != "" {
+		p.Log("%s %s [%s]", r.Method, r.URL.Path, requestID)
+	} else {
+		p.Log("%s %s", r.Method, r.URL.Path)
+	}
+
+	// 健康检查请求
+	if r.URL.Path == p.basePath+healthPath {
+		w.Write([]byte("ok"))
+		return
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 
-	// 从路径中提取 groupName 和 key
+	// 从路径中提取 groupName 和 key，批量请求的路径中只有 groupName
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "bad request", http.StatusBadRequest)
+	batch := r.Method == http.MethodPost && len(parts) == 1
+	if len(parts) != 2 && !batch {
+		writeError(w, r, fmt.Errorf("%w: path must be %s<group>/<key>", ErrBadRequest, p.basePath))
 		return
 	}
 
 	groupName := parts[0]
-	key := parts[1]
+	var key string
+	if !batch {
+		key = parts[1]
+	}
+
+	// 先认证再查找 group，避免未认证的调用方探测 group 是否存在
+	principal, err := Authorize(p.auth, p.acl, r, groupName)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
 
 	// 获取对应的 Group
 	group := GetGroup(groupName)
 	if group == nil {
-		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		writeError(w, r, fmt.Errorf("%w: %s", ErrNoSuchGroup, groupName))
 		return
 	}
 
-	// 从缓存中获取数据
-	view, err := group.Get(key)
+	if batch {
+		p.serveBatch(w, r, group)
+		return
+	}
+
+	// 其他节点下线前推送过来的热点数据
+	if r.Method == http.MethodPut {
+		// 只有集群中的节点可以写入缓存，没有配置节点认证时无法区分，一律拒绝
+		if p.auth == nil || principal != PeerPrincipal {
+			writeError(w, r, ErrForbidden)
+			return
+		}
+		p.receiveHandoff(w, r, group, key)
+		return
+	}
+
+	// 哈希环变化后新节点的询问只查本地缓存，不加载也不转发，避免两个节点互相等待
+	peek := r.URL.Query().Get(peekParam) != ""
+	view, err := peerLookup(group, key, peek, r.Header.Get(acceptNotFoundHeader) != "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
+	qps := group.stats.hit(key)
 
-	// 将值写入响应体，并以 proto 消息格式返回
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	// 大 value 分块传输，其余的以 proto 消息格式返回
+	if p.shouldStream(r, view) {
+		writeStream(w, r, view)
+		return
+	}
+	res := &pb.Response{MinuteQps: qps, RequestId: requestID}
+	if err := fillResponse(res, view, r.Header.Get(acceptEncodingHeader)); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	body, err := proto.Marshal(res)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
@@ -86,33 +179,147 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // Set 更新节点池中的节点列表
 func (p *HTTPPool) Set(peers ...string) {
+	labeled := make([]Peer, len(peers))
+	for i, peer := range peers {
+		labeled[i] = Peer{Addr: peer}
+	}
+	p.SetPeers(labeled...)
+}
+
+// SetPeers 更新节点池中的节点列表，并记录每个节点的权重和拓扑标签
+func (p *HTTPPool) SetPeers(peers ...Peer) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	// 使用一致性哈希来管理节点
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	// 为每个节点创建一个 httpGetter
+	// 记住变化前的哈希环，过渡期内新的负责节点会先询问之前的负责节点
+	if p.grace > 0 && p.peers != nil {
+		p.prev = p.peers
+		p.prevPeekers = make(map[string]*httpGetter, len(p.httpGetters))
+		for addr, h := range p.httpGetters {
+			p.prevPeekers[addr] = &httpGetter{baseURL: h.baseURL, peer: addr, pool: p, peek: true}
+		}
+		p.prevUntil = time.Now().Add(p.grace)
+	}
+	p.members = append([]Peer(nil), peers...)
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	p.topology = make(map[string]Topology, len(peers))
+	health := make(map[string]*peerHealth, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		// 为每个节点创建一个 httpGetter
+		p.httpGetters[peer.Addr] = &httpGetter{baseURL: peer.Addr + p.basePath, peer: peer.Addr, pool: p}
+		p.topology[peer.Addr] = peer.Topology
+		// 仍在列表中的节点保留原来的健康状况
+		if h, ok := p.health[peer.Addr]; ok {
+			health[peer.Addr] = h
+		} else {
+			health[peer.Addr] = &peerHealth{}
+		}
 	}
+	p.health = health
+	p.rebuildLocked()
+}
+
+// rebuildLocked 用未被弹出的节点重建哈希环，调用方需持有 p.mu
+func (p *HTTPPool) rebuildLocked() {
+	// 使用一致性哈希来管理节点
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	for _, peer := range p.members {
+		if p.draining && peer.Addr == p.self {
+			continue
+		}
+		if !p.health[peer.Addr].ejected {
+			p.peers.AddWeighted(peer.Addr, peer.Weight)
+		}
+	}
+}
+
+// SetReplicaSetSize 设置每个 key 的副本集合大小。
+// 大于 1 时，副本会尽量分布在不同的可用区和机架上，
+// 并且 PickPeer 会优先选择与当前节点同可用区的副本。
+func (p *HTTPPool) SetReplicaSetSize(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replicaSet = n
+}
+
+// ReplicaSet 返回负责 key 的副本节点，第一个为主节点
+func (p *HTTPPool) ReplicaSet(key string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.replicaSetLocked(key)
+}
+
+// replicaSetLocked 计算 key 的副本集合，调用方需持有 p.mu
+func (p *HTTPPool) replicaSetLocked(key string) []string {
+	if p.peers == nil {
+		return nil
+	}
+	if p.replicaSet <= 1 {
+		if peer := p.peers.Get(key); peer != "" {
+			return []string{peer}
+		}
+		return nil
+	}
+	// 按环上顺序取出全部节点，再从中挑选跨故障域的副本
+	candidates := p.peers.GetN(key, len(p.httpGetters))
+	return spreadReplicas(candidates, p.topology, p.replicaSet)
 }
 
 // PickPeer 根据 key 选择一个远程节点
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	// 根据一致性哈希算法选择一个节点
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	// 下线过程中只从本地读取，避免与仍把 key 路由到这里的节点互相转发
+	if p.draining {
+		return nil, false
+	}
+	// 根据一致性哈希算法选择 key 的副本集合
+	replicas := p.replicaSetLocked(key)
+	if len(replicas) == 0 {
+		return nil, false
+	}
+	peer := replicas[0]
+	// 读请求优先落在同一可用区内，避免跨区流量
+	if zone := p.topology[p.self].Zone; zone != "" {
+		for _, r := range replicas {
+			if r == p.self {
+				return nil, false
+			}
+		}
+		for _, r := range replicas {
+			if p.topology[r].Zone == zone {
+				peer = r
+				break
+			}
+		}
+	}
+	if peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+// Getter 返回节点 peer 的 PeerGetter，peer 不在节点列表中或是当前节点时返回 false。
+// 与 PickPeer 不同，它不经过哈希环，用于向指定的副本发送请求
+func (p *HTTPPool) Getter(peer string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := p.httpGetters[peer]
+	if !ok || peer == p.self {
+		return nil, false
+	}
+	return h, true
+}
+
 // httpGetter 实现了 PeerGetter 接口，用于从远程节点获取数据
 type httpGetter struct {
-	baseURL string // 远程节点的基本 URL
+	baseURL string    // 远程节点的基本 URL
+	peer    string    // 远程节点的 URL
+	pool    *HTTPPool // 所属的节点池，用于记录请求结果
+	peek    bool      // 只读取远程节点已缓存的数据
 }
 
 // Get 从远程节点获取数据
@@ -124,24 +331,61 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 		url.QueryEscape(in.GetGroup()),
 		url.QueryEscape(in.GetKey()),
 	)
+	if h.peek {
+		u += "?" + peekParam + "=1"
+	}
 
 	// 发送 HTTP GET 请求
-	res, err := http.Get(u)
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", protobufMediaType)
+	req.Header.Set(streamHeader, "1")
+	req.Header.Set(acceptEncodingHeader, acceptedEncodings())
+	req.Header.Set(acceptNotFoundHeader, "1")
+	if id := in.GetRequestId(); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	res, err := h.pool.do(req)
+	// 只有连接层面的失败才计入节点的故障次数，节点返回的错误响应说明它仍然存活
+	h.pool.observe(h.peer, err == nil)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	// 如果响应状态码不是 200 OK，则返回错误
+	// 如果响应状态码不是 200 OK，则返回带有错误类型的 PeerError
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return readError(h.peer, res)
+	}
+
+	// 大 value 以原始字节分块传输
+	limit := h.pool.maxResponseBytes
+	if res.Header.Get(streamHeader) != "" {
+		value, err := readStream(res, limit)
+		if err != nil {
+			return err
+		}
+		out.Reset()
+		out.Value, out.Encoding = value, res.Header.Get(encodingHeader)
+		out.Expire, _ = strconv.ParseInt(res.Header.Get(expireHeader), 10, 64)
+		out.Version, _ = strconv.ParseUint(res.Header.Get(versionHeader), 10, 64)
+		out.ContentType = res.Header.Get(contentTypeHeader)
+		flags, _ := strconv.ParseUint(res.Header.Get(flagsHeader), 10, 32)
+		out.Flags = uint32(flags)
+		out.RequestId = in.GetRequestId()
+		return nil
 	}
 
-	// 读取响应体
-	bytes, err := ioutil.ReadAll(res.Body)
+	// 读取响应体，多读一个字节用于判断是否超过上限
+	bytes, err := ioutil.ReadAll(io.LimitReader(res.Body, limit+1))
 	if err != nil {
 		return fmt.Errorf("reading response body: %v", err)
 	}
+	if int64(len(bytes)) > limit {
+		return fmt.Errorf("response body exceeds %d bytes", limit)
+	}
 
 	// 解析响应体中的 proto 数据
 	if err = proto.Unmarshal(bytes, out); err != nil {
@@ -151,5 +395,28 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
-// 确保 httpGetter 实现了 PeerGetter 接口
-var _ PeerGetter = (*httpGetter)(nil)
+// do 为请求签名后发送给其他节点
+func (p *HTTPPool) do(req *http.Request) (*http.Response, error) {
+	if p.signer != nil {
+		if err := p.signer.Sign(req); err != nil {
+			return nil, fmt.Errorf("signing request: %v", err)
+		}
+	}
+	return p.client.Do(req)
+}
+
+// String 返回节点的地址
+func (h *httpGetter) String() string {
+	return h.peer
+}
+
+// Addr 实现了 PeerAddresser 接口
+func (h *httpGetter) Addr() string {
+	return h.peer
+}
+
+// 确保 httpGetter 实现了 PeerGetter 和 PeerAddresser 接口
+var (
+	_ PeerGetter    = (*httpGetter)(nil)
+	_ PeerAddresser = (*httpGetter)(nil)
+)
@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTimeout          = 5 * time.Second // 默认的单次请求超时时间
+	defaultMaxIdleConns     = 32              // 默认每个节点保留的空闲连接数
+	defaultMaxResponseBytes = 64 << 20        // 默认的最大响应体大小
+)
+
+// HTTPPoolOption 用于配置 HTTPPool
+type HTTPPoolOption func(*HTTPPool)
+
+// WithTransport 使用自定义的 http.RoundTripper 向其他节点发送请求。
+// 设置后 WithMaxIdleConnsPerPeer、WithMaxConnsPerPeer 和 WithTLS 不再生效，由 rt 自行管理连接
+func WithTransport(rt http.RoundTripper) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.transport = rt
+	}
+}
+
+// WithTimeout 设置向其他节点请求的超时时间，包括读取响应体的时间，0 表示不超时
+func WithTimeout(d time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.timeout = d
+	}
+}
+
+// WithMaxIdleConnsPerPeer 设置每个节点保留的最大空闲连接数
+func WithMaxIdleConnsPerPeer(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.maxIdleConns = n
+	}
+}
+
+// WithMaxConnsPerPeer 限制与每个节点同时建立的连接数，0 表示不限制。
+// 一个节点变慢时，请求会排队等待连接，而不是耗尽文件描述符
+func WithMaxConnsPerPeer(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.maxConns = n
+	}
+}
+
+// WithMaxResponseSize 限制从其他节点读取的响应体大小，超过时请求失败
+func WithMaxResponseSize(n int64) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.maxResponseBytes = n
+	}
+}
+
+// newClient 根据配置创建向其他节点发送请求的 http.Client
+func (p *HTTPPool) newClient() *http.Client {
+	rt := p.transport
+	if rt == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConnsPerHost = p.maxIdleConns
+		t.MaxConnsPerHost = p.maxConns
+		if p.tlsConfig != nil {
+			t.TLSClientConfig = p.tlsConfig
+		}
+		rt = t
+	}
+	return &http.Client{Transport: rt, Timeout: p.timeout}
+}
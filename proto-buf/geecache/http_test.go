@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// countingTransport 记录经过的请求数
+type countingTransport struct {
+	n int
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.n++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHTTPPoolOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/slow"):
+			time.Sleep(200 * time.Millisecond)
+		case strings.HasSuffix(r.URL.Path, "/big"):
+			body, _ := proto.Marshal(&pb.Response{Value: make([]byte, 1024)})
+			w.Write(body)
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("ok")})
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	rt := &countingTransport{}
+	p := NewHTTPPool("http://self",
+		WithTransport(rt),
+		WithTimeout(50*time.Millisecond),
+		WithMaxResponseSize(512),
+	)
+	p.Set(server.URL)
+
+	get := func(key string) error {
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatalf("PickPeer(%s) should pick the remote node", key)
+		}
+		return peer.Get(&pb.Request{Group: "scores", Key: key}, &pb.Response{})
+	}
+
+	if err := get("Tom"); err != nil {
+		t.Errorf("Get(Tom) failed: %v", err)
+	}
+	if err := get("slow"); err == nil {
+		t.Errorf("expect timeout for slow response")
+	}
+	if err := get("big"); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("expect size limit error for big response, got %v", err)
+	}
+	if rt.n != 3 {
+		t.Errorf("custom transport saw %d requests, expect 3", rt.n)
+	}
+}
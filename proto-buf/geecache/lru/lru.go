@@ -83,7 +83,33 @@ func (c *Cache) RemoveOldest() {
 	}
 }
 
+// Remove 从缓存中删除一个键，键不存在时什么也不做
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.ll.Remove(ele)
+		kv := ele.Value.(*entry)
+		delete(c.cache, kv.key)
+		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	}
+}
+
 // Len 返回缓存中条目的数量
 func (c *Cache) Len() int {
 	return c.ll.Len() // 返回链表中元素的个数
 }
+
+// Bytes 返回缓存当前占用的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// Walk 按从最近到最久访问的顺序遍历缓存条目，不改变条目的访问顺序。
+// fn 返回 false 时停止遍历
+func (c *Cache) Walk(fn func(key string, value Value) bool) {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*entry)
+		if !fn(kv.key, kv.value) {
+			return
+		}
+	}
+}
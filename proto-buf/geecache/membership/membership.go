@@ -0,0 +1,588 @@
+package membership
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State 表示成员的状态
+type State int
+
+const (
+	StateAlive   State = iota // 存活
+	StateSuspect              // 疑似故障，仍然参与路由
+	StateDead                 // 确认故障
+	StateLeft                 // 主动离开
+)
+
+// String 返回状态的名称
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// live 判断该状态的成员是否应该出现在哈希环上
+func (s State) live() bool {
+	return s == StateAlive || s == StateSuspect
+}
+
+// Member 描述集群中的一个成员
+type Member struct {
+	Name        string `json:"name"` // 成员名称，通常是节点对外服务的 URL，例如 "http://localhost:8001"
+	Addr        string `json:"addr"` // gossip 地址，例如 "127.0.0.1:7946"
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"inc"` // 化身号，只能由成员自己递增，用于反驳怀疑
+}
+
+// Config 是 Memberlist 的配置，零值字段会使用默认值
+type Config struct {
+	Name             string               // 当前成员的名称，必须在集群内唯一
+	BindAddr         string               // gossip 监听的 UDP 地址，例如 "127.0.0.1:0"
+	ProbeInterval    time.Duration        // 两次探测之间的间隔
+	ProbeTimeout     time.Duration        // 等待 ack 的超时时间
+	IndirectProbes   int                  // 直接探测失败后发起间接探测的成员数
+	SuspicionTimeout time.Duration        // 疑似故障多久后确认为故障
+	OnChange         func(live []Member)  // 存活成员集合变化时回调，参数包含当前成员自己
+	Logf             func(string, ...any) // 可选的日志函数
+}
+
+const (
+	defaultProbeInterval    = time.Second
+	defaultProbeTimeout     = 300 * time.Millisecond
+	defaultIndirectProbes   = 3
+	defaultSuspicionTimeout = 5 * time.Second
+	maxPiggyback            = 16    // 每条消息最多捎带的状态更新数
+	maxPacketSize           = 65507 // UDP 报文的最大负载
+)
+
+// msgType 是 gossip 消息的类型
+type msgType int
+
+const (
+	msgPing    msgType = iota // 直接探测
+	msgPingReq                // 请求其他成员代为探测
+	msgAck                    // 探测应答
+	msgJoin                   // 加入集群，应答中携带完整的成员列表
+)
+
+// message 是成员之间交换的 gossip 消息
+type message struct {
+	Type    msgType  `json:"type"`
+	Seq     uint64   `json:"seq"`
+	From    string   `json:"from"`             // 发送方名称
+	Target  string   `json:"target,omitempty"` // ping-req 的探测目标地址
+	Updates []Member `json:"updates,omitempty"`
+}
+
+// broadcast 是一条等待捎带传播的状态更新
+type broadcast struct {
+	member    Member
+	transmits int // 剩余的发送次数
+}
+
+// Memberlist 基于 SWIM 协议维护集群成员关系：
+// 周期性地随机探测成员，直接探测失败时通过其他成员间接探测，
+// 仍然失败则标记为疑似故障，超时未被反驳即确认故障。
+// 成员状态的变化捎带在探测消息中以 gossip 的方式传播。
+type Memberlist struct {
+	cfg  Config
+	conn *net.UDPConn
+	addr string // 实际监听的 gossip 地址
+
+	mu         sync.Mutex             // 保护以下字段
+	members    map[string]*Member     // 按名称索引的成员，包含自己
+	broadcasts map[string]*broadcast  // 按成员名称索引的待传播更新
+	acks       map[uint64]func()      // 按序号索引的 ack 处理函数
+	suspicions map[string]*time.Timer // 按成员名称索引的疑似故障计时器
+	seq        uint64                 // 下一条探测消息的序号
+	probeOrder []string               // 本轮探测的成员顺序
+	probeIdx   int                    // 本轮探测进行到的位置
+	rnd        *rand.Rand             // 随机数生成器
+	notify     chan struct{}          // 通知 OnChange 协程成员集合有变化
+	done       chan struct{}          // 关闭时通知后台协程退出
+	wg         sync.WaitGroup         // 等待后台协程退出
+	closeOnce  sync.Once              // 确保只关闭一次
+}
+
+// New 创建 Memberlist 并开始监听和探测，随后调用 Join 加入已有集群
+func New(cfg Config) (*Memberlist, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("membership: name is required")
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	if cfg.IndirectProbes <= 0 {
+		cfg.IndirectProbes = defaultIndirectProbes
+	}
+	if cfg.SuspicionTimeout <= 0 {
+		cfg.SuspicionTimeout = defaultSuspicionTimeout
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, fmt.Errorf("membership: resolving bind address: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("membership: listening: %v", err)
+	}
+
+	m := &Memberlist{
+		cfg:        cfg,
+		conn:       conn,
+		addr:       conn.LocalAddr().String(),
+		members:    make(map[string]*Member),
+		broadcasts: make(map[string]*broadcast),
+		acks:       make(map[uint64]func()),
+		suspicions: make(map[string]*time.Timer),
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	m.members[cfg.Name] = &Member{Name: cfg.Name, Addr: m.addr, State: StateAlive}
+	m.notifyLocked()
+
+	m.wg.Add(3)
+	go m.readLoop()
+	go m.probeLoop()
+	go m.notifyLoop()
+	return m, nil
+}
+
+// Addr 返回实际监听的 gossip 地址
+func (m *Memberlist) Addr() string {
+	return m.addr
+}
+
+// Members 返回按名称排序的存活成员（包括疑似故障的成员和自己）
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.liveLocked()
+}
+
+// Join 通过种子地址加入集群，返回成功联系上的种子数量
+func (m *Memberlist) Join(seeds ...string) (int, error) {
+	joined := 0
+	var lastErr error
+	for _, seed := range seeds {
+		if seed == m.addr {
+			continue
+		}
+		acked := make(chan struct{})
+		seq := m.register(func() { close(acked) })
+		m.mu.Lock()
+		self := *m.members[m.cfg.Name]
+		m.mu.Unlock()
+		if err := m.send(seed, message{Type: msgJoin, Seq: seq, Updates: []Member{self}}); err != nil {
+			m.unregister(seq)
+			lastErr = err
+			continue
+		}
+		select {
+		case <-acked:
+			joined++
+		case <-time.After(3 * m.cfg.ProbeTimeout):
+			m.unregister(seq)
+			lastErr = fmt.Errorf("membership: no response from seed %s", seed)
+		case <-m.done:
+			return joined, errors.New("membership: closed")
+		}
+	}
+	if joined == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+	return joined, nil
+}
+
+// Leave 通知其他成员自己主动离开，然后关闭
+func (m *Memberlist) Leave() error {
+	m.mu.Lock()
+	self := m.members[m.cfg.Name]
+	self.Incarnation++
+	self.State = StateLeft
+	update := *self
+	var targets []string
+	for _, mem := range m.members {
+		if mem.Name != m.cfg.Name && mem.State.live() {
+			targets = append(targets, mem.Addr)
+		}
+	}
+	m.mu.Unlock()
+
+	// 直接告知每个存活成员，不依赖后续的 gossip
+	for _, addr := range targets {
+		m.send(addr, message{Type: msgPing, Seq: m.register(func() {}), Updates: []Member{update}})
+	}
+	return m.Close()
+}
+
+// Close 停止探测并关闭监听，不通知其他成员
+func (m *Memberlist) Close() error {
+	var err error
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = m.conn.Close()
+		m.mu.Lock()
+		for name, t := range m.suspicions {
+			t.Stop()
+			delete(m.suspicions, name)
+		}
+		m.mu.Unlock()
+		m.wg.Wait()
+	})
+	return err
+}
+
+// readLoop 接收并处理 gossip 消息
+func (m *Memberlist) readLoop() {
+	defer m.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+				m.cfg.Logf("[Membership %s] read error: %v", m.cfg.Name, err)
+				continue
+			}
+		}
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			m.cfg.Logf("[Membership %s] decoding message from %s: %v", m.cfg.Name, from, err)
+			continue
+		}
+		m.handle(msg, from.String())
+	}
+}
+
+// handle 处理一条 gossip 消息
+func (m *Memberlist) handle(msg message, from string) {
+	for _, u := range msg.Updates {
+		m.merge(u)
+	}
+
+	switch msg.Type {
+	case msgPing:
+		m.send(from, message{Type: msgAck, Seq: msg.Seq})
+	case msgJoin:
+		// 新成员需要完整的成员列表，而不仅是最近的更新
+		m.mu.Lock()
+		all := make([]Member, 0, len(m.members))
+		for _, mem := range m.members {
+			all = append(all, *mem)
+		}
+		m.mu.Unlock()
+		m.send(from, message{Type: msgAck, Seq: msg.Seq, Updates: all})
+	case msgPingReq:
+		// 代为探测目标，收到 ack 后转发给请求方
+		seq := m.register(func() {
+			m.send(from, message{Type: msgAck, Seq: msg.Seq})
+		})
+		time.AfterFunc(m.cfg.ProbeTimeout, func() { m.unregister(seq) })
+		m.send(msg.Target, message{Type: msgPing, Seq: seq})
+	case msgAck:
+		m.mu.Lock()
+		fn, ok := m.acks[msg.Seq]
+		delete(m.acks, msg.Seq)
+		m.mu.Unlock()
+		if ok {
+			fn()
+		}
+	}
+}
+
+// merge 按照 SWIM 的优先级规则合并一条成员状态更新
+func (m *Memberlist) merge(u Member) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 关于自己的负面消息：递增化身号并广播存活来反驳
+	if u.Name == m.cfg.Name {
+		self := m.members[m.cfg.Name]
+		if self.State == StateAlive && u.State != StateAlive && u.Incarnation >= self.Incarnation {
+			self.Incarnation = u.Incarnation + 1
+			m.queueLocked(*self)
+		}
+		return
+	}
+
+	cur, ok := m.members[u.Name]
+	if !ok {
+		mem := u
+		m.members[u.Name] = &mem
+		m.queueLocked(mem)
+		if mem.State == StateSuspect {
+			m.suspectLocked(mem)
+		}
+		if mem.State.live() {
+			m.notifyLocked()
+		}
+		return
+	}
+
+	var accept bool
+	switch u.State {
+	case StateAlive:
+		accept = u.Incarnation > cur.Incarnation
+	case StateSuspect:
+		accept = cur.State.live() &&
+			(u.Incarnation > cur.Incarnation || (u.Incarnation == cur.Incarnation && cur.State == StateAlive))
+	case StateDead, StateLeft:
+		accept = cur.State.live() && u.Incarnation >= cur.Incarnation
+	}
+	if !accept {
+		return
+	}
+
+	wasLive := cur.State.live()
+	*cur = u
+	m.queueLocked(u)
+	if t, ok := m.suspicions[u.Name]; ok && u.State != StateSuspect {
+		t.Stop()
+		delete(m.suspicions, u.Name)
+	}
+	if u.State == StateSuspect {
+		m.suspectLocked(u)
+	}
+	if wasLive != u.State.live() {
+		m.cfg.Logf("[Membership %s] %s is %s", m.cfg.Name, u.Name, u.State)
+		m.notifyLocked()
+	}
+}
+
+// suspectLocked 为疑似故障的成员启动计时器，超时未被反驳则确认故障
+func (m *Memberlist) suspectLocked(u Member) {
+	if t, ok := m.suspicions[u.Name]; ok {
+		t.Stop()
+	}
+	m.suspicions[u.Name] = time.AfterFunc(m.cfg.SuspicionTimeout, func() {
+		m.mu.Lock()
+		cur, ok := m.members[u.Name]
+		if !ok || cur.State != StateSuspect || cur.Incarnation != u.Incarnation {
+			m.mu.Unlock()
+			return
+		}
+		delete(m.suspicions, u.Name)
+		m.mu.Unlock()
+		m.merge(Member{Name: u.Name, Addr: u.Addr, State: StateDead, Incarnation: u.Incarnation})
+	})
+}
+
+// probeLoop 周期性地探测成员
+func (m *Memberlist) probeLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.probe()
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// probe 探测下一个成员：先直接 ping，超时后通过其他成员间接 ping，
+// 在本轮探测周期结束前仍未收到 ack 则将其标记为疑似故障
+func (m *Memberlist) probe() {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+
+	acked := make(chan struct{})
+	seq := m.register(func() { close(acked) })
+	defer m.unregister(seq)
+
+	m.send(target.Addr, message{Type: msgPing, Seq: seq})
+	select {
+	case <-acked:
+		return
+	case <-time.After(m.cfg.ProbeTimeout):
+	case <-m.done:
+		return
+	}
+
+	for _, helper := range m.randomLive(m.cfg.IndirectProbes, target.Name) {
+		m.send(helper.Addr, message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+	}
+	wait := m.cfg.ProbeInterval - m.cfg.ProbeTimeout
+	if wait < m.cfg.ProbeTimeout {
+		wait = m.cfg.ProbeTimeout
+	}
+	select {
+	case <-acked:
+		return
+	case <-time.After(wait):
+	case <-m.done:
+		return
+	}
+
+	m.cfg.Logf("[Membership %s] no ack from %s, suspecting", m.cfg.Name, target.Name)
+	m.merge(Member{Name: target.Name, Addr: target.Addr, State: StateSuspect, Incarnation: target.Incarnation})
+}
+
+// nextTarget 以随机轮转的顺序选出下一个被探测的成员
+func (m *Memberlist) nextTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for attempts := 0; attempts < 2; attempts++ {
+		for m.probeIdx < len(m.probeOrder) {
+			name := m.probeOrder[m.probeIdx]
+			m.probeIdx++
+			if mem, ok := m.members[name]; ok && mem.State.live() {
+				return *mem, true
+			}
+		}
+		// 一轮结束，重新打乱顺序
+		m.probeOrder = m.probeOrder[:0]
+		for name, mem := range m.members {
+			if name != m.cfg.Name && mem.State.live() {
+				m.probeOrder = append(m.probeOrder, name)
+			}
+		}
+		m.rnd.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+		m.probeIdx = 0
+	}
+	return Member{}, false
+}
+
+// randomLive 随机选出至多 k 个存活成员，不包括自己和 exclude
+func (m *Memberlist) randomLive(k int, exclude string) []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var candidates []Member
+	for name, mem := range m.members {
+		if name != m.cfg.Name && name != exclude && mem.State.live() {
+			candidates = append(candidates, *mem)
+		}
+	}
+	m.rnd.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
+
+// register 分配一个序号并登记收到对应 ack 时的处理函数
+func (m *Memberlist) register(fn func()) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq++
+	m.acks[m.seq] = fn
+	return m.seq
+}
+
+// unregister 取消登记的 ack 处理函数
+func (m *Memberlist) unregister(seq uint64) {
+	m.mu.Lock()
+	delete(m.acks, seq)
+	m.mu.Unlock()
+}
+
+// send 捎带待传播的状态更新后发送消息
+func (m *Memberlist) send(addr string, msg message) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	msg.From = m.cfg.Name
+	msg.Updates = append(msg.Updates, m.piggyback(maxPiggyback)...)
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = m.conn.WriteToUDP(body, raddr)
+	return err
+}
+
+// piggyback 取出至多 limit 条待传播的更新，每条更新只会被发送有限次
+func (m *Memberlist) piggyback(limit int) []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var updates []Member
+	for name, b := range m.broadcasts {
+		if len(updates) == limit {
+			break
+		}
+		updates = append(updates, b.member)
+		if b.transmits--; b.transmits <= 0 {
+			delete(m.broadcasts, name)
+		}
+	}
+	return updates
+}
+
+// queueLocked 将一条更新加入待传播队列，覆盖同一成员的旧更新
+func (m *Memberlist) queueLocked(u Member) {
+	// 发送次数随集群规模对数增长，保证更新以高概率传遍集群
+	transmits := 3 * int(math.Ceil(math.Log2(float64(len(m.members)+1))))
+	m.broadcasts[u.Name] = &broadcast{member: u, transmits: transmits}
+}
+
+// liveLocked 返回按名称排序的存活成员
+func (m *Memberlist) liveLocked() []Member {
+	live := make([]Member, 0, len(m.members))
+	for _, mem := range m.members {
+		if mem.State.live() {
+			live = append(live, *mem)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].Name < live[j].Name })
+	return live
+}
+
+// notifyLocked 通知 OnChange 协程存活成员集合发生了变化
+func (m *Memberlist) notifyLocked() {
+	select {
+	case m.notify <- struct{}{}:
+	default: // 已有未处理的通知，回调时会读取最新的成员集合
+	}
+}
+
+// notifyLoop 在独立的协程中按顺序调用 OnChange，避免回调阻塞 gossip
+func (m *Memberlist) notifyLoop() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.notify:
+			if m.cfg.OnChange != nil {
+				m.cfg.OnChange(m.Members())
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package membership
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestNode(t *testing.T, name string, onChange func([]Member)) *Memberlist {
+	m, err := New(Config{
+		Name:             name,
+		BindAddr:         "127.0.0.1:0",
+		ProbeInterval:    50 * time.Millisecond,
+		ProbeTimeout:     20 * time.Millisecond,
+		SuspicionTimeout: 200 * time.Millisecond,
+		OnChange:         onChange,
+		Logf:             t.Logf,
+	})
+	if err != nil {
+		t.Fatalf("New(%s) failed: %v", name, err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// waitMembers 等待节点看到的存活成员数量变为 n
+func waitMembers(t *testing.T, m *Memberlist, n int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(m.Members()) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("%s sees %v, expect %d members", m.cfg.Name, m.Members(), n)
+}
+
+func TestJoinAndFailureDetection(t *testing.T) {
+	var mu sync.Mutex
+	var last []Member
+	seed := newTestNode(t, "node-0", func(live []Member) {
+		mu.Lock()
+		last = live
+		mu.Unlock()
+	})
+
+	nodes := []*Memberlist{seed}
+	for i := 1; i < 4; i++ {
+		n := newTestNode(t, fmt.Sprintf("node-%d", i), nil)
+		if _, err := n.Join(seed.Addr()); err != nil {
+			t.Fatalf("Join failed: %v", err)
+		}
+		nodes = append(nodes, n)
+	}
+	for _, n := range nodes {
+		waitMembers(t, n, 4)
+	}
+
+	// 直接关闭，不通知其他成员，依靠探测发现故障
+	nodes[3].Close()
+	for _, n := range nodes[:3] {
+		waitMembers(t, n, 3)
+	}
+
+	// 主动离开的成员会被立即移除
+	nodes[2].Leave()
+	for _, n := range nodes[:2] {
+		waitMembers(t, n, 2)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(last) != 2 || last[0].Name != "node-0" || last[1].Name != "node-1" {
+		t.Errorf("OnChange got %v, expect node-0 and node-1", last)
+	}
+}
+
+func TestRejoinAfterDeath(t *testing.T) {
+	seed := newTestNode(t, "node-0", nil)
+	n := newTestNode(t, "node-1", nil)
+	if _, err := n.Join(seed.Addr()); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	waitMembers(t, seed, 2)
+
+	n.Close()
+	waitMembers(t, seed, 1)
+
+	// 重启后的成员通过递增化身号反驳之前的故障判定
+	restarted := newTestNode(t, "node-1", nil)
+	if _, err := restarted.Join(seed.Addr()); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	waitMembers(t, seed, 2)
+	waitMembers(t, restarted, 2)
+}
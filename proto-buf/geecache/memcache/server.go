@@ -0,0 +1,580 @@
+package memcache
+
+import (
+	"Cache/proto-buf/geecache"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxKeyLength  = 250               // key 的最大长度，与 memcached 相同
+	maxLineLength = 64 << 10          // 命令行的最大长度，get 可以一次带很多 key
+	maxValueSize  = 1 << 20           // value 的最大长度，与 memcached 的 item_size_max 默认值相同
+	relativeLimit = 30 * 24 * 60 * 60 // 不超过 30 天的过期时间是相对秒数，超过时是 Unix 时间戳
+	version       = "geecache"
+)
+
+// ErrServerClosed 在 Server 关闭后由 Serve 返回
+var ErrServerClosed = errors.New("memcache: server closed")
+
+// Config 是 memcached 协议服务器的配置
+type Config struct {
+	// DefaultGroup 是不带 "group:" 前缀的 key 所属的 Group，为空时这样的 key 视为不存在。
+	// 前缀不是已注册 Group 的 key 也整体属于 DefaultGroup，
+	// 因此原本直接使用 memcached 的服务不需要修改 "session:abc" 这样的 key 就能切换过来
+	DefaultGroup string
+
+	// Auth 不为 nil 时连接必须先认证才能执行其他命令。与 memcached 的 ASCII 协议认证相同，
+	// 客户端发送的第一条 set 的数据块是 "<username> <token>"，token 按 "Authorization: Bearer <token>"
+	// 交给 Auth 校验，例如 geecache.TokenAuth。ACL 不为 nil 时按认证得到的身份检查每个 key 所属 group 的访问权限
+	Auth geecache.Authenticator
+	ACL  *geecache.ACL
+	Logf func(string, ...any) // 可选的日志函数
+}
+
+// stats 记录 stats 命令输出的计数
+type stats struct {
+	totalConns   atomic.Int64
+	cmdGet       atomic.Int64
+	getHits      atomic.Int64
+	getMisses    atomic.Int64
+	cmdSet       atomic.Int64
+	cmdTouch     atomic.Int64
+	touchHits    atomic.Int64
+	touchMisses  atomic.Int64
+	deleteHits   atomic.Int64
+	deleteMisses atomic.Int64
+}
+
+// Server 通过 memcached 文本协议对外提供 Group，支持 get、gets、set、delete、touch、stats、version 和 quit。
+// key 的格式为 "group:key"，读取时调用 GetGroup(group).Get(key)，
+// 因此未命中的 key 同样会经过 singleflight、远程节点和 Getter 加载。
+// set、delete 和 touch 只修改当前节点的缓存；set 的 flags 与 value 一起保存，
+// 从数据源加载的 value 的 flags 为 0；gets 返回的 cas 是 value 的版本
+type Server struct {
+	cfg   Config
+	start time.Time
+	stats stats
+
+	mu        sync.Mutex // 保护以下字段
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup // 等待所有连接处理完毕
+}
+
+// NewServer 创建一个 memcached 协议服务器
+func NewServer(cfg Config) *Server {
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	return &Server{
+		cfg:       cfg,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听 TCP 地址 addr 并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 接受 l 上的连接，每个连接由单独的 goroutine 处理。Close 后返回 ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		s.stats.totalConns.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭所有监听器和连接，并等待正在处理的命令完成
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// clients 返回当前的连接数
+func (s *Server) clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// serveConn 依次读取并执行连接上的命令，客户端流水线发送的多条命令在一次写入中返回
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	sess := &session{authed: s.cfg.Auth == nil}
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				w.WriteString("CLIENT_ERROR line too long\r\n")
+				w.Flush()
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				s.cfg.Logf("[Memcache] %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			w.WriteString("ERROR\r\n")
+			continue
+		}
+		quit, err := s.exec(r, w, sess, fields)
+		if err != nil {
+			// 读取 set 的数据块失败，连接上的数据已经无法对齐
+			w.Flush()
+			return
+		}
+		if quit {
+			return
+		}
+		// 缓冲区中没有后续命令时才写出，流水线的多个回复合并为一次写入
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// session 是一个连接的认证状态
+type session struct {
+	authed    bool   // 是否可以执行命令，没有配置 Auth 时总是为 true
+	principal string // 认证得到的身份
+}
+
+// errAccessDenied 表示连接认证得到的身份无权访问 key 所属的 Group
+var errAccessDenied = errors.New("access denied")
+
+// exec 执行一条命令并写入回复，返回是否应该关闭连接。返回的错误表示连接不能继续使用
+func (s *Server) exec(r *bufio.Reader, w *bufio.Writer, sess *session, fields []string) (bool, error) {
+	args := fields[1:]
+	if !sess.authed {
+		// 认证之前只能执行 set（作为认证）和 quit
+		switch fields[0] {
+		case "set":
+			return false, s.auth(r, w, sess, args)
+		case "quit":
+			return true, nil
+		}
+		w.WriteString("CLIENT_ERROR unauthenticated\r\n")
+		return false, nil
+	}
+	switch fields[0] {
+	case "get", "gets":
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+			return false, nil
+		}
+		s.get(w, sess, args, fields[0] == "gets")
+	case "set":
+		return false, s.set(r, w, sess, args)
+	case "delete":
+		s.delete(w, sess, args)
+	case "touch":
+		s.touch(w, sess, args)
+	case "stats":
+		s.writeStats(w)
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+	case "quit":
+		return true, nil
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+// auth 处理认证用的 set，数据块是 "<username> <token>"，username 被忽略。只有数据块无法读取时才返回错误
+func (s *Server) auth(r *bufio.Reader, w *bufio.Writer, sess *session, args []string) error {
+	if len(args) < 4 {
+		w.WriteString("ERROR\r\n")
+		return nil
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return errors.New("invalid data length")
+	}
+	data, err := readBlock(r, size)
+	if err != nil {
+		if errors.Is(err, errBadChunk) {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		}
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		w.WriteString("CLIENT_ERROR authentication failure\r\n")
+		return nil
+	}
+	req := &http.Request{Header: http.Header{"Authorization": {"Bearer " + fields[1]}}}
+	principal, err := s.cfg.Auth.Authenticate(req)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR authentication failure\r\n")
+		return nil
+	}
+	sess.authed, sess.principal = true, principal
+	w.WriteString("STORED\r\n")
+	return nil
+}
+
+// group 解析 key 并检查连接能否访问它所属的 Group，Group 不存在时返回 nil
+func (s *Server) group(sess *session, key string) (*geecache.Group, string, error) {
+	g, k := s.resolve(key)
+	if g != nil && s.cfg.Auth != nil && s.cfg.ACL != nil && !s.cfg.ACL.Allowed(g.Name(), sess.principal) {
+		return nil, "", errAccessDenied
+	}
+	return g, k, nil
+}
+
+// resolve 解析 "group:key" 形式的 key，返回对应的 Group 和组内的 key，Group 不存在时返回 nil。
+// 设置了 DefaultGroup 时，前缀不是已注册 Group 的 key（例如 "session:abc"）整体属于 DefaultGroup
+func (s *Server) resolve(key string) (*geecache.Group, string) {
+	if name, k, ok := strings.Cut(key, ":"); ok {
+		if g := geecache.GetGroup(name); g != nil || s.cfg.DefaultGroup == "" {
+			return g, k
+		}
+	}
+	if s.cfg.DefaultGroup == "" {
+		return nil, ""
+	}
+	return geecache.GetGroup(s.cfg.DefaultGroup), key
+}
+
+// get 处理 get 和 gets，同一个 Group 的 key 通过 GetMulti 一次读取。
+// 与 memcached 相同，读取失败的 key 视为未命中
+func (s *Server) get(w *bufio.Writer, sess *session, keys []string, cas bool) {
+	for _, key := range keys {
+		if len(key) > maxKeyLength {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return
+		}
+	}
+	type ref struct {
+		group *geecache.Group
+		key   string
+	}
+	refs := make([]ref, len(keys))
+	byGroup := make(map[*geecache.Group][]string)
+	for i, key := range keys {
+		if g, k, _ := s.group(sess, key); g != nil {
+			refs[i] = ref{g, k}
+			byGroup[g] = append(byGroup[g], k)
+		}
+	}
+	results := make(map[*geecache.Group]map[string]geecache.Result, len(byGroup))
+	for g, ks := range byGroup {
+		results[g] = g.GetMulti(ks)
+	}
+
+	s.stats.cmdGet.Add(int64(len(keys)))
+	for i, r := range refs {
+		if r.group == nil {
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		res := results[r.group][r.key]
+		var b []byte
+		if res.Err == nil {
+			b, res.Err = res.Value.Bytes()
+		}
+		if res.Err != nil {
+			if !errors.Is(res.Err, geecache.ErrNotFound) {
+				s.cfg.Logf("[Memcache] get %s: %v", keys[i], res.Err)
+			}
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		s.stats.getHits.Add(1)
+		if cas {
+			fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", keys[i], res.Value.Flags(), len(b), res.Value.Version())
+		} else {
+			fmt.Fprintf(w, "VALUE %s %d %d\r\n", keys[i], res.Value.Flags(), len(b))
+		}
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// set 处理 set <key> <flags> <exptime> <bytes> [noreply]，之后的一行是数据块。
+// 只有数据块无法读取时才返回错误
+func (s *Server) set(r *bufio.Reader, w *bufio.Writer, sess *session, args []string) error {
+	if len(args) < 4 || len(args) > 5 {
+		w.WriteString("ERROR\r\n")
+		return nil
+	}
+	noreply := len(args) == 5 && args[4] == "noreply"
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return errors.New("invalid data length")
+	}
+	// 先读完数据块，即使命令有误也不能把数据当作下一条命令
+	data, err := readBlock(r, size)
+	if err != nil {
+		if errors.Is(err, errBadChunk) {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		}
+		return err
+	}
+	s.stats.cmdSet.Add(1)
+
+	reply := func(msg string) {
+		if !noreply {
+			w.WriteString(msg + "\r\n")
+		}
+	}
+	key := args[0]
+	flags, flagsErr := strconv.ParseUint(args[1], 10, 32)
+	exptime, expErr := strconv.ParseInt(args[2], 10, 64)
+	switch {
+	case len(key) > maxKeyLength || flagsErr != nil || expErr != nil || (len(args) == 5 && !noreply):
+		reply("CLIENT_ERROR bad command line format")
+		return nil
+	case data == nil:
+		reply("SERVER_ERROR object too large for cache")
+		return nil
+	}
+	g, k, err := s.group(sess, key)
+	if err != nil {
+		reply("CLIENT_ERROR " + err.Error())
+		return nil
+	}
+	if g == nil {
+		reply("SERVER_ERROR no such group")
+		return nil
+	}
+	ttl, expired := expiry(exptime)
+	if expired {
+		g.Remove(k) // 已经过期的 value 不需要写入
+		reply("STORED")
+		return nil
+	}
+	if err := g.SetWithFlags(k, data, uint32(flags), ttl); err != nil {
+		reply("SERVER_ERROR " + err.Error())
+		return nil
+	}
+	reply("STORED")
+	return nil
+}
+
+// delete 处理 delete <key> [noreply]
+func (s *Server) delete(w *bufio.Writer, sess *session, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	noreply := len(args) == 2 && args[1] == "noreply"
+	g, k, err := s.group(sess, args[0])
+	if err != nil {
+		w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+		return
+	}
+	removed := false
+	if g != nil {
+		removed = g.Remove(k)
+	}
+	msg := "NOT_FOUND\r\n"
+	if removed {
+		s.stats.deleteHits.Add(1)
+		msg = "DELETED\r\n"
+	} else {
+		s.stats.deleteMisses.Add(1)
+	}
+	if !noreply {
+		w.WriteString(msg)
+	}
+}
+
+// touch 处理 touch <key> <exptime> [noreply]，只修改当前节点缓存中的 key
+func (s *Server) touch(w *bufio.Writer, sess *session, args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	noreply := len(args) == 3 && args[2] == "noreply"
+	exptime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	g, k, err := s.group(sess, args[0])
+	if err != nil {
+		w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+		return
+	}
+	s.stats.cmdTouch.Add(1)
+	touched := false
+	if g != nil {
+		if ttl, expired := expiry(exptime); expired {
+			touched = g.Remove(k)
+		} else {
+			touched = g.Touch(k, ttl)
+		}
+	}
+	msg := "NOT_FOUND\r\n"
+	if touched {
+		s.stats.touchHits.Add(1)
+		msg = "TOUCHED\r\n"
+	} else {
+		s.stats.touchMisses.Add(1)
+	}
+	if !noreply {
+		w.WriteString(msg)
+	}
+}
+
+// writeStats 处理 stats，输出与 memcached 同名的计数
+func (s *Server) writeStats(w *bufio.Writer) {
+	now := time.Now()
+	stat := func(name string, value any) {
+		fmt.Fprintf(w, "STAT %s %v\r\n", name, value)
+	}
+	stat("pid", os.Getpid())
+	stat("uptime", int64(now.Sub(s.start).Seconds()))
+	stat("time", now.Unix())
+	stat("version", version)
+	stat("curr_connections", s.clients())
+	stat("total_connections", s.stats.totalConns.Load())
+	stat("cmd_get", s.stats.cmdGet.Load())
+	stat("cmd_set", s.stats.cmdSet.Load())
+	stat("cmd_touch", s.stats.cmdTouch.Load())
+	stat("get_hits", s.stats.getHits.Load())
+	stat("get_misses", s.stats.getMisses.Load())
+	stat("delete_hits", s.stats.deleteHits.Load())
+	stat("delete_misses", s.stats.deleteMisses.Load())
+	stat("touch_hits", s.stats.touchHits.Load())
+	stat("touch_misses", s.stats.touchMisses.Load())
+	w.WriteString("END\r\n")
+}
+
+// expiry 把 memcached 的 exptime 转换为有效期：0 表示使用 Group 的 TTL，
+// 不超过 30 天时是相对秒数，超过时是 Unix 时间戳，负数或者已经过去的时间戳表示立即过期
+func expiry(exptime int64) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime <= relativeLimit:
+		return time.Duration(exptime) * time.Second, false
+	}
+	ttl = time.Until(time.Unix(exptime, 0))
+	return ttl, ttl <= 0
+}
+
+var (
+	errLineTooLong = errors.New("line too long")
+	errBadChunk    = errors.New("data chunk is not terminated by CRLF")
+)
+
+// readLine 读取一行命令并去掉结尾的 CRLF
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > maxLineLength {
+			return "", errLineTooLong
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// readBlock 读取 set 的数据块和结尾的 CRLF。超过 maxValueSize 的数据块被丢弃，返回 nil
+func readBlock(r *bufio.Reader, size int) ([]byte, error) {
+	if size > maxValueSize {
+		if _, err := io.CopyN(io.Discard, r, int64(size)+2); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, errBadChunk
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,208 @@
+package memcache
+
+import (
+	"Cache/proto-buf/geecache"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip 发送 req 并读取 n 行回复
+func roundTrip(t *testing.T, conn net.Conn, r *bufio.Reader, req string, n int) string {
+	t.Helper()
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%q: %v after %q", req, err, b.String())
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func TestServer(t *testing.T) {
+	loads := 0
+	g := geecache.NewGroup("memcache-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+		}))
+	g.SetNegativeTTL(time.Minute)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{DefaultGroup: "memcache-scores"})
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"get memcache-scores:Tom\r\n", 3, "VALUE memcache-scores:Tom 0 3\r\n630\r\nEND\r\n"},
+		{"get Tom kkk unknown:Tom\r\n", 3, "VALUE Tom 0 3\r\n630\r\nEND\r\n"},
+		// 前缀不是 group 的 key 整体属于 DefaultGroup
+		{"set session:abc 0 0 1\r\n1\r\n", 1, "STORED\r\n"},
+		{"get session:abc\r\n", 3, "VALUE session:abc 0 1\r\n1\r\nEND\r\n"},
+		{"set Sam 5 100 3\r\n567\r\n", 1, "STORED\r\n"},
+		{"get Sam\r\n", 3, "VALUE Sam 5 3\r\n567\r\nEND\r\n"}, // flags 与 value 一起保存
+		{"set Sam 0 0 3 noreply\r\n568\r\nget Sam\r\n", 3, "VALUE Sam 0 3\r\n568\r\nEND\r\n"},
+		{"set Sam 0 0 3\r\n5678\r\n", 1, "CLIENT_ERROR bad data chunk\r\n"},
+	}
+	for _, tt := range tests {
+		if got := roundTrip(t, conn, r, tt.req, tt.lines); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.req, got, tt.want)
+		}
+	}
+
+	// 数据块错误后连接被关闭，重新连接
+	conn, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r = bufio.NewReader(conn)
+
+	tests = []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"set big 0 0 2000000\r\n" + strings.Repeat("x", 2000000) + "\r\n", 1, "SERVER_ERROR object too large for cache\r\n"},
+		{"touch Sam 100\r\n", 1, "TOUCHED\r\n"},
+		{"touch nothing 100\r\n", 1, "NOT_FOUND\r\n"},
+		{"delete Sam\r\n", 1, "DELETED\r\n"},
+		{"delete Sam\r\n", 1, "NOT_FOUND\r\n"},
+		{"set Sam 0 -1 3\r\n567\r\n", 1, "STORED\r\n"},
+		{"get Sam\r\n", 1, "END\r\n"}, // 立即过期的 value 不会写入，从数据源加载也不存在
+		{"version\r\n", 1, "VERSION geecache\r\n"},
+		{"flush_all\r\n", 1, "ERROR\r\n"},
+	}
+	for _, tt := range tests {
+		if got := roundTrip(t, conn, r, tt.req, tt.lines); got != tt.want {
+			t.Errorf("%.40q = %q, want %q", tt.req, got, tt.want)
+		}
+	}
+
+	// gets 返回 value 的版本作为 cas
+	got := roundTrip(t, conn, r, "gets Tom\r\n", 3)
+	want := fmt.Sprintf("VALUE Tom 0 3 %d\r\n630\r\nEND\r\n", mustGet(t, g, "Tom").Version())
+	if got != want {
+		t.Errorf("gets = %q, want %q", got, want)
+	}
+
+	if _, err := io.WriteString(conn, "stats\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	stats := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "END\r\n" {
+			break
+		}
+		f := strings.Fields(line)
+		stats[f[1]] = f[2]
+	}
+	if stats["get_hits"] != "6" || stats["get_misses"] != "3" || stats["curr_connections"] != "1" {
+		t.Errorf("stats = %v", stats)
+	}
+	if loads != 4 { // Tom、kkk、unknown:Tom 和删除后的 Sam 各加载一次
+		t.Errorf("getter called %d times, want 4", loads)
+	}
+
+	if _, err := io.WriteString(conn, "quit\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("connection not closed after quit: %v", err)
+	}
+
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+}
+
+func mustGet(t *testing.T, g *geecache.Group, key string) geecache.ByteView {
+	t.Helper()
+	v, err := g.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestServerAuth(t *testing.T) {
+	getter := geecache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	})
+	geecache.NewGroup("memcache-alice", 2<<10, getter)
+	geecache.NewGroup("memcache-bob", 2<<10, getter)
+	acl := geecache.NewACL()
+	acl.Allow("memcache-alice", "alice")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{
+		DefaultGroup: "memcache-alice",
+		Auth:         geecache.TokenAuth{"t1": "alice"},
+		ACL:          acl,
+		Logf:         t.Logf,
+	})
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	for _, tt := range []struct {
+		req   string
+		lines int
+		want  string
+	}{
+		{"get Tom\r\n", 1, "CLIENT_ERROR unauthenticated\r\n"},
+		{"set auth 0 0 11\r\nalice wrong\r\n", 1, "CLIENT_ERROR authentication failure\r\n"},
+		{"set auth 0 0 8\r\nalice t1\r\n", 1, "STORED\r\n"},
+		{"get Tom\r\n", 3, "VALUE Tom 0 5\r\nv-Tom\r\nEND\r\n"},
+		{"get memcache-bob:Tom\r\n", 1, "END\r\n"},
+		{"set memcache-bob:Tom 0 0 1\r\n1\r\n", 1, "CLIENT_ERROR access denied\r\n"},
+		{"delete memcache-bob:Tom\r\n", 1, "CLIENT_ERROR access denied\r\n"},
+	} {
+		if got := roundTrip(t, conn, r, tt.req, tt.lines); got != tt.want {
+			t.Errorf("%q = %q, want %q", tt.req, got, tt.want)
+		}
+	}
+}
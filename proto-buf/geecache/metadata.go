@@ -0,0 +1,193 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	requestIDHeader = "X-Request-Id" // 请求 ID，HTTP 中通过请求头传递
+	// acceptNotFoundHeader 表示请求方能够处理 not_found 响应，
+	// 旧版本的节点不认识这个字段，会把空 value 当作正常的值，因此只在请求方声明时使用。gRPC 中使用同名的 metadata
+	acceptNotFoundHeader = "X-Geecache-Accept-Not-Found"
+	expireHeader         = "X-Geecache-Expire"       // 分块传输的 value 的过期时间
+	versionHeader        = "X-Geecache-Version"      // 分块传输的 value 的版本
+	contentTypeHeader    = "X-Geecache-Content-Type" // 分块传输的 value 的媒体类型
+	flagsHeader          = "X-Geecache-Flags"        // 分块传输的 value 的客户端标志
+
+	qpsWindow = time.Minute // 统计 QPS 的时间窗口
+)
+
+// SetTTL 设置从数据源加载的 value 的有效期，0 表示不过期。过期时间随 value 一起传给其他节点
+func (g *Group) SetTTL(ttl time.Duration) {
+	g.ttl = ttl
+}
+
+// SetNegativeTTL 设置不存在的 key 的缓存时间：Getter 返回 ErrNotFound 后，
+// 这段时间内再次请求直接返回 ErrNotFound，不再访问数据源。0 表示不缓存
+func (g *Group) SetNegativeTTL(ttl time.Duration) {
+	g.negativeTTL = ttl
+}
+
+// SetHotKeyQPS 设置热点 key 的阈值：负责 key 的节点报告的 QPS 达到 qps 时，
+// 请求方在本地也缓存一份，之后的请求不再访问远程节点。0 表示不在本地缓存
+func (g *Group) SetHotKeyQPS(qps float64) {
+	g.hotQPS = qps
+}
+
+// newView 封装从数据源加载的数据，设置版本和过期时间
+func (g *Group) newView(b []byte) ByteView {
+	now := time.Now()
+	v := ByteView{b: cloneBytes(b), version: uint64(now.UnixNano())}
+	if g.ttl > 0 {
+		v.expire = now.Add(g.ttl)
+	}
+	return v
+}
+
+// notFoundError 返回 key 不存在的错误
+func notFoundError(key string) error {
+	return fmt.Errorf("%s: %w", key, ErrNotFound)
+}
+
+// peerLookup 处理其他节点对 key 的请求，peek 为 true 时只查本地缓存。
+// 请求方支持 not_found 时，不存在的 key 以 notFound 的 ByteView 返回，否则返回 ErrNotFound
+func peerLookup(group *Group, key string, peek, acceptNotFound bool) (ByteView, error) {
+	var view ByteView
+	var err error
+	if peek {
+		var ok bool
+		if view, ok = group.mainCache.get(key); !ok {
+			return ByteView{}, fmt.Errorf("%w: %s is not cached", ErrNotFound, key)
+		}
+	} else if view, err = group.lookup(key); errors.Is(err, ErrNotFound) {
+		view, err = ByteView{notFound: true}, nil
+	}
+	if err != nil {
+		return ByteView{}, err
+	}
+	if view.notFound && !acceptNotFound {
+		return ByteView{}, notFoundError(key)
+	}
+	return view, nil
+}
+
+// fillResponse 把 view 及其元数据写入 res，accept 是请求方能够解压的格式
+func fillResponse(res *pb.Response, view ByteView, accept string) error {
+	if view.notFound {
+		res.NotFound = true
+	} else {
+		b, encoding, err := wireValue(view, accept)
+		if err != nil {
+			return err
+		}
+		res.Value, res.Encoding = b, encoding
+	}
+	res.Expire = unixMilli(view.expire)
+	res.Version = view.version
+	res.ContentType, res.Flags = view.contentType, view.flags
+	return nil
+}
+
+// viewFromResponse 把远程节点的响应转换为 ByteView
+func viewFromResponse(res *pb.Response) (ByteView, error) {
+	if res.GetNotFound() {
+		return ByteView{notFound: true, expire: fromUnixMilli(res.GetExpire())}, nil
+	}
+	v, err := viewFromWire(res.GetValue(), res.GetEncoding())
+	v.expire = fromUnixMilli(res.GetExpire())
+	v.version = res.GetVersion()
+	v.contentType, v.flags = res.GetContentType(), res.GetFlags()
+	return v, err
+}
+
+// DecodeResponse 把远程节点对 key 的响应转换为 ByteView，key 不存在时返回 ErrNotFound。
+// 供不经过 Group、直接向节点发送请求的客户端使用
+func DecodeResponse(key string, res *pb.Response) (ByteView, error) {
+	v, err := viewFromResponse(res)
+	if err == nil && v.notFound {
+		return ByteView{}, notFoundError(key)
+	}
+	return v, err
+}
+
+// unixMilli 把时间转换为 Unix 毫秒时间戳，零值转换为 0
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// fromUnixMilli 把 Unix 毫秒时间戳转换为时间，0 转换为零值
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// newRequestID 生成一个随机的请求 ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// keyStats 统计每个 key 被其他节点请求的 QPS，只保留当前和上一个时间窗口的计数
+type keyStats struct {
+	mu     sync.Mutex
+	start  time.Time        // 当前窗口的开始时间
+	counts map[string]int64 // 当前窗口的请求次数
+	prev   map[string]int64 // 上一个窗口的请求次数
+}
+
+// hit 记录一次对 key 的请求，返回 key 最近的 QPS
+func (s *keyStats) hit(key string) float64 {
+	if s == nil {
+		return 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotateLocked(now)
+	s.counts[key]++
+	return s.qpsLocked(key, now)
+}
+
+// qps 返回 key 最近的 QPS，不记录请求
+func (s *keyStats) qps(key string) float64 {
+	if s == nil {
+		return 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotateLocked(now)
+	return s.qpsLocked(key, now)
+}
+
+// rotateLocked 在当前窗口结束时开始新的窗口
+func (s *keyStats) rotateLocked(now time.Time) {
+	if elapsed := now.Sub(s.start); elapsed >= qpsWindow {
+		s.prev = s.counts
+		if elapsed >= 2*qpsWindow {
+			s.prev = nil // 上一个窗口内没有请求
+		}
+		s.counts = make(map[string]int64)
+		s.start = now
+	}
+}
+
+// qpsLocked 取上一个完整窗口和当前窗口中较大的 QPS，当前窗口不足一秒时按一秒计算
+func (s *keyStats) qpsLocked(key string, now time.Time) float64 {
+	qps := float64(s.prev[key]) / qpsWindow.Seconds()
+	elapsed := math.Max(now.Sub(s.start).Seconds(), 1)
+	return math.Max(qps, float64(s.counts[key])/elapsed)
+}
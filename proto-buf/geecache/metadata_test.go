@@ -0,0 +1,95 @@
+package geecache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTTLAndNegativeCache(t *testing.T) {
+	loads := make(map[string]int)
+	g := NewGroup("meta-ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		if key == "missing" {
+			return nil, ErrNotFound
+		}
+		return []byte("v-" + key), nil
+	}))
+	g.SetTTL(50 * time.Millisecond)
+	g.SetNegativeTTL(time.Minute)
+
+	v, _ := g.Get("Tom")
+	if v.Expire().IsZero() || v.Version() == 0 {
+		t.Fatalf("loaded value should carry expiry and version, got %v %d", v.Expire(), v.Version())
+	}
+	g.Get("Tom")
+	if loads["Tom"] != 1 {
+		t.Fatalf("value should be cached before it expires, loaded %d times", loads["Tom"])
+	}
+	time.Sleep(80 * time.Millisecond)
+	g.Get("Tom")
+	if loads["Tom"] != 2 {
+		t.Fatalf("expired value should be reloaded, loaded %d times", loads["Tom"])
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(missing) error = %v, want ErrNotFound", err)
+		}
+	}
+	if loads["missing"] != 1 {
+		t.Fatalf("not found result should be cached, loaded %d times", loads["missing"])
+	}
+}
+
+func TestMetadataPropagation(t *testing.T) {
+	remote := NewGroup("meta-remote", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	remote.SetTTL(time.Hour)
+
+	var mu sync.Mutex
+	var requestIDs []string
+	pool := NewHTTPPool("http://remote")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestIDs = append(requestIDs, r.Header.Get(requestIDHeader))
+		mu.Unlock()
+		pool.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	g := peerGroup("meta-remote", GetterFunc(func(key string) ([]byte, error) {
+		return nil, errors.New("unexpected local load")
+	}))
+	g.SetHotKeyQPS(1)
+	p := NewHTTPPool("http://self")
+	p.Set(server.URL)
+	g.RegisterPeers(p)
+
+	v, err := g.Get("Tom")
+	if err != nil || v.String() != "v-Tom" {
+		t.Fatalf("Get(Tom) = %q, %v", v.String(), err)
+	}
+	if d := time.Until(v.Expire()); d < 59*time.Minute || v.Version() == 0 {
+		t.Errorf("expiry and version should come from the owner, got expire in %v, version %d", d, v.Version())
+	}
+	// 负责节点报告的 QPS 达到阈值，请求方在本地保留了一份
+	g.Get("Tom")
+	if len(requestIDs) != 1 || requestIDs[0] == "" {
+		t.Errorf("expect one request with a request ID, got %q", requestIDs)
+	}
+
+	// 写入时指定的媒体类型随 value 一起传给请求方
+	remote.SetWithContentType("Sam", []byte(`{"score":567}`), "application/json", 0)
+	if v, err := g.Get("Sam"); err != nil || v.ContentType() != "application/json" {
+		t.Errorf("Get(Sam) content type = %q, %v", v.ContentType(), err)
+	}
+	remote.SetWithFlags("Jack", []byte("589"), 42, 0)
+	if v, err := g.Get("Jack"); err != nil || v.Flags() != 42 {
+		t.Errorf("Get(Jack) flags = %d, %v", v.Flags(), err)
+	}
+}
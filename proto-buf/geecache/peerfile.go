@@ -0,0 +1,152 @@
+package geecache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultWatchInterval 是检查节点列表文件是否变化的默认间隔
+const defaultWatchInterval = 2 * time.Second
+
+// PeerFile 是节点列表配置文件的内容。只支持 JSON 格式：模块没有依赖 YAML 解析库，
+// YAML 格式的配置需要先转换为 JSON，扩展名为 .yaml 或 .yml 的文件会直接报错。例如：
+//
+//	{
+//	  "self": "http://10.0.0.1:8001",
+//	  "basePath": "/_geecache/",
+//	  "peers": [
+//	    {"addr": "http://10.0.0.1:8001", "zone": "a"},
+//	    {"addr": "http://10.0.0.2:8001", "zone": "b", "weight": 2}
+//	  ]
+//	}
+type PeerFile struct {
+	Self     string `json:"self"`               // 当前节点的 URL
+	BasePath string `json:"basePath,omitempty"` // 节点间通信的基础路径，默认为 "/_geecache/"
+	Peers    []Peer `json:"peers"`              // 集群中的全部节点，包括当前节点
+}
+
+// parsePeerFile 解析并校验节点列表配置
+func parsePeerFile(data []byte) (*PeerFile, error) {
+	f := &PeerFile{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields() // 拼错的字段名应该直接报错，而不是被悄悄忽略
+	if err := dec.Decode(f); err != nil {
+		return nil, fmt.Errorf("decoding peer file: %v", err)
+	}
+	if f.Self == "" {
+		return nil, fmt.Errorf("peer file: self is required")
+	}
+	if f.BasePath == "" {
+		f.BasePath = defaultBasePath
+	}
+	if len(f.Peers) == 0 {
+		return nil, fmt.Errorf("peer file: at least one peer is required")
+	}
+	seen := make(map[string]bool, len(f.Peers))
+	for _, peer := range f.Peers {
+		if u, err := url.Parse(peer.Addr); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("peer file: invalid peer address %q", peer.Addr)
+		}
+		if seen[peer.Addr] {
+			return nil, fmt.Errorf("peer file: duplicate peer %s", peer.Addr)
+		}
+		if peer.Weight < 0 {
+			return nil, fmt.Errorf("peer file: negative weight for peer %s", peer.Addr)
+		}
+		seen[peer.Addr] = true
+	}
+	return f, nil
+}
+
+// readPeerFile 读取节点列表配置文件，拒绝不支持的 YAML 文件
+func readPeerFile(path string) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return nil, fmt.Errorf("peer file %s: YAML is not supported, use JSON", path)
+	}
+	return os.ReadFile(path)
+}
+
+// LoadPeerFile 读取并校验节点列表配置文件
+func LoadPeerFile(path string) (*PeerFile, error) {
+	data, err := readPeerFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePeerFile(data)
+}
+
+// NewHTTPPoolFromFile 根据节点列表配置文件创建 HTTP 节点池
+func NewHTTPPoolFromFile(path string, opts ...HTTPPoolOption) (*HTTPPool, error) {
+	data, err := readPeerFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parsePeerFile(data)
+	if err != nil {
+		return nil, err
+	}
+	p := NewHTTPPool(f.Self, opts...)
+	p.basePath = f.BasePath
+	p.SetPeers(f.Peers...)
+	p.peerFile = data
+	return p, nil
+}
+
+// WatchPeerFile 周期性地检查节点列表配置文件，内容变化且校验通过时重新设置节点池。
+// 校验失败的修改会被忽略，节点池保持原来的节点列表。
+// self 和 basePath 在运行时不能修改，修改它们需要重启节点。
+// 返回的 stop 函数用于停止监视。
+func (p *HTTPPool) WatchPeerFile(path string, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	// 从已经应用的内容开始比较，节点池不是由该文件创建时第一次检查就应用文件的内容
+	p.mu.Lock()
+	last := p.peerFile
+	p.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+
+			data, err := readPeerFile(path)
+			if err != nil {
+				p.Log("reading peer file: %v", err)
+				continue
+			}
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+
+			f, err := parsePeerFile(data)
+			if err != nil {
+				p.Log("ignoring peer file change: %v", err)
+				continue
+			}
+			if f.Self != p.self || f.BasePath != p.basePath {
+				p.Log("self or basePath changed in peer file, restart required to apply")
+			}
+			// SetPeers 在一次加锁中替换整个哈希环，不会出现新旧节点混杂的中间状态
+			p.SetPeers(f.Peers...)
+			p.mu.Lock()
+			p.peerFile = data
+			p.mu.Unlock()
+			p.Log("peer list reloaded from %s: %d peers", path, len(f.Peers))
+		}
+	}()
+	return func() { close(done) }
+}
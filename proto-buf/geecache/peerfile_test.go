@@ -0,0 +1,96 @@
+package geecache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchPeerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"self": "http://a", "peers": [{"addr": "http://a"}]}`)
+
+	p, err := NewHTTPPoolFromFile(path)
+	if err != nil {
+		t.Fatalf("NewHTTPPoolFromFile failed: %v", err)
+	}
+	stop := p.WatchPeerFile(path, 10*time.Millisecond)
+	defer stop()
+
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("single node pool should load Tom locally")
+	}
+
+	waitFor := func(expect []string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			p.mu.Lock()
+			var got []string
+			for addr := range p.httpGetters {
+				got = append(got, addr)
+			}
+			p.mu.Unlock()
+			sort.Strings(got)
+			if reflect.DeepEqual(got, expect) {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("peer list not reloaded, expect %v", expect)
+	}
+
+	write(`{"self": "http://a", "peers": [{"addr": "http://a"}, {"addr": "http://b", "weight": 100}]}`)
+	waitFor([]string{"http://a", "http://b"})
+	if _, ok := p.PickPeer("Tom"); !ok {
+		t.Errorf("heavily weighted peer b should own Tom")
+	}
+
+	// 非法的修改被忽略，节点池保持不变
+	write(`{"self": "http://a", "peers": [{"addr": "not a url"}]}`)
+	time.Sleep(50 * time.Millisecond)
+	waitFor([]string{"http://a", "http://b"})
+}
+
+func TestWatchPeerFileAppliesInitialContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.json")
+	if err := os.WriteFile(path, []byte(`{"self": "http://a", "peers": [{"addr": "http://a"}, {"addr": "http://b"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 节点池不是由该文件创建的，文件的内容还没有被应用过
+	p := NewHTTPPool("http://a")
+	p.Set("http://a")
+	stop := p.WatchPeerFile(path, 10*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		p.mu.Lock()
+		n := len(p.httpGetters)
+		p.mu.Unlock()
+		if n == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("peer file content was not applied")
+}
+
+func TestLoadPeerFileRejectsYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.yaml")
+	if err := os.WriteFile(path, []byte("self: http://a\npeers:\n  - addr: http://a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPeerFile(path); err == nil || !strings.Contains(err.Error(), "YAML is not supported") {
+		t.Errorf("LoadPeerFile(%s) error = %v, want YAML is not supported", path, err)
+	}
+}
@@ -17,3 +17,43 @@ type PeerGetter interface {
 	// 参数 `in` 是请求，`out` 是响应，返回错误信息（如果有）。
 	Get(in *pb.Request, out *pb.Response) error
 }
+
+// PeerAddresser 是 PeerGetter 可选实现的接口，返回远程节点的地址。
+// 地址用于错误信息，也用于判断两个 PeerGetter 是否指向同一个节点。
+type PeerAddresser interface {
+	Addr() string
+}
+
+// peerAddr 返回 peer 的地址，peer 没有实现 PeerAddresser 时返回空字符串
+func peerAddr(peer PeerGetter) string {
+	if a, ok := peer.(PeerAddresser); ok {
+		return a.Addr()
+	}
+	return ""
+}
+
+// samePeer 判断 a 和 b 是否指向同一个节点，无法得知地址时视为不同的节点
+func samePeer(a, b PeerGetter) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	addr := peerAddr(a)
+	return addr != "" && addr == peerAddr(b)
+}
+
+// PreviousPeerPicker 是 PeerPicker 可选实现的接口。
+// 节点列表刚发生变化时，当前节点成为某个 key 的新负责节点，
+// 本地加载之前会先向变化前负责该 key 的节点读取它已缓存的数据。
+type PreviousPeerPicker interface {
+	// PickPreviousPeer 返回变化前负责 key 的远程节点，
+	// 不在过渡期内或者之前的负责节点就是自己时返回 false。
+	PickPreviousPeer(key string) (peer PeerGetter, ok bool)
+}
+
+// BatchPeerGetter 是 PeerGetter 可选实现的接口，
+// 用一次请求从节点获取同一个 group 中的多个 key。
+type BatchPeerGetter interface {
+	// GetMulti 的 out.Results 与 in.Keys 一一对应，单个 key 的失败记录在对应的 Result 中，
+	// 返回的错误表示整个请求失败。
+	GetMulti(in *pb.BatchRequest, out *pb.BatchResponse) error
+}
@@ -0,0 +1,38 @@
+package geecache
+
+import "time"
+
+// peekParam 是只读取已缓存数据的查询参数
+const peekParam = "peek"
+
+// SetRebalanceGrace 设置节点列表变化后的过渡期。
+// 过渡期内，成为新负责节点的当前节点在本地加载前，
+// 会先向变化前负责该 key 的节点读取它已缓存的数据，避免扩缩容时集中回源。
+// d 为 0 时关闭该功能。
+func (p *HTTPPool) SetRebalanceGrace(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.grace = d
+}
+
+// PickPreviousPeer 实现了 PreviousPeerPicker 接口
+func (p *HTTPPool) PickPreviousPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prev == nil || time.Now().After(p.prevUntil) {
+		return nil, false
+	}
+	peer := p.prev.Get(key)
+	if peer == "" || peer == p.self {
+		return nil, false
+	}
+	// 之前的负责节点已被弹出，就不必再等它超时了
+	if h, ok := p.health[peer]; ok && h.ejected {
+		return nil, false
+	}
+	p.Log("Pick previous peer %s", peer)
+	return p.prevPeekers[peer], true
+}
+
+// 确保 HTTPPool 实现了 PreviousPeerPicker 接口
+var _ PreviousPeerPicker = (*HTTPPool)(nil)
@@ -0,0 +1,98 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestRebalanceAsksPreviousOwner(t *testing.T) {
+	// 之前的负责节点只响应只读缓存的询问
+	previous := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get(peekParam) == "" {
+			http.Error(w, "expect a peek request", http.StatusBadRequest)
+			return
+		}
+		body, _ := proto.Marshal(&pb.Response{Value: []byte("warm")})
+		w.Write(body)
+	}))
+	defer previous.Close()
+
+	loads := 0
+	g := NewGroup("rebalance", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte("cold"), nil
+	}))
+
+	self := "http://self"
+	p := NewHTTPPool(self)
+	p.SetRebalanceGrace(time.Minute)
+	p.Set(previous.URL) // 变化前所有 key 都由 previous 负责
+	p.Set(self)         // 变化后所有 key 都由当前节点负责
+	g.RegisterPeers(p)
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "warm" || loads != 0 {
+		t.Fatalf("Get(Tom) = %q, %v with %d loads, expect value from previous owner", v, err, loads)
+	}
+
+	// 过渡期结束后直接从本地加载
+	p.mu.Lock()
+	p.prevUntil = time.Now()
+	p.mu.Unlock()
+	if v, err := g.Get("Jack"); err != nil || v.String() != "cold" || loads != 1 {
+		t.Fatalf("Get(Jack) = %q, %v with %d loads, expect local load", v, err, loads)
+	}
+}
+
+func TestRebalanceSkipsFailedOwner(t *testing.T) {
+	// 变化前后都由同一个节点负责，它请求失败后不应再以只读询问的方式重复请求
+	requests := 0
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer owner.Close()
+
+	g := NewGroup("rebalance-failed", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("local"), nil
+	}))
+	p := NewHTTPPool("http://self")
+	p.SetRebalanceGrace(time.Minute)
+	p.Set(owner.URL)
+	p.Set(owner.URL)
+	g.RegisterPeers(p)
+
+	if v, err := g.Get("Tom"); err != nil || v.String() != "local" || requests != 1 {
+		t.Fatalf("Get(Tom) = %q, %v with %d requests, expect one request then local load", v, err, requests)
+	}
+}
+
+func TestSamePeer(t *testing.T) {
+	a := &httpGetter{peer: "http://a"}
+	tests := []struct {
+		x, y PeerGetter
+		want bool
+	}{
+		{a, &httpGetter{peer: "http://a", peek: true}, true},
+		{a, &tcpGetter{peer: "http://b"}, false},
+		{a, nil, false},
+		// 没有实现 PeerAddresser 的节点无法比较，视为不同的节点
+		{peerGetterFunc(nil), peerGetterFunc(nil), false},
+	}
+	for i, tt := range tests {
+		if got := samePeer(tt.x, tt.y); got != tt.want {
+			t.Errorf("case %d: samePeer = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+// peerGetterFunc 把函数适配为没有地址的 PeerGetter
+type peerGetterFunc func(in *pb.Request, out *pb.Response) error
+
+func (f peerGetterFunc) Get(in *pb.Request, out *pb.Response) error {
+	return f(in, out)
+}
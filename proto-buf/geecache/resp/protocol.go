@@ -0,0 +1,134 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// protocolError 表示客户端发来的数据不符合 RESP 协议，回复错误后关闭连接
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand 读取一条命令。客户端库发送的是由 bulk string 组成的数组，
+// telnet 等工具发送的 inline 命令按空白分割。authed 为 false 时按认证之前的限制读取
+func readCommand(r *bufio.Reader, authed bool) ([]string, error) {
+	argLimit, bulkLimit := maxArgs, maxBulkSize
+	if !authed {
+		argLimit, bulkLimit = maxUnauthArgs, maxUnauthBulkSize
+	}
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := readLine(r, maxInline)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(line), nil
+	}
+
+	line, err := readLine(r, maxInline)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > argLimit {
+		return nil, protocolError("invalid multibulk length")
+	}
+	// 按声明的个数预分配，但不超过 1024，实际的参数读到后再扩容
+	args := make([]string, 0, min(max(n, 0), 1024))
+	for i := 0; i < n; i++ {
+		line, err := readLine(r, maxInline)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + truncate(line) + "'")
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > bulkLimit {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, protocolError("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+// readLine 读取一行并去掉结尾的 CRLF，行的长度不能超过 limit
+func readLine(r *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		frag, err := r.ReadSlice('\n')
+		line = append(line, frag...)
+		if len(line) > limit {
+			return "", protocolError("too big inline request")
+		}
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			if err == io.EOF && len(line) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// writer 以 RESP 格式写入回复
+type writer struct {
+	*bufio.Writer
+}
+
+// status 写入简单字符串，例如 +OK
+func (w *writer) status(s string) {
+	w.WriteString("+" + s + "\r\n")
+}
+
+// error 写入错误，s 以错误类型开头，例如 "ERR syntax error"
+func (w *writer) error(s string) {
+	// 错误信息中不能出现换行，否则客户端会把剩余部分当作下一条回复
+	s = strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+	w.WriteString("-" + s + "\r\n")
+}
+
+// arity 写入参数个数错误
+func (w *writer) arity(cmd string) {
+	w.error("ERR wrong number of arguments for '" + cmd + "' command")
+}
+
+// integer 写入整数
+func (w *writer) integer(n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+// bulk 写入 bulk string
+func (w *writer) bulk(b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// null 写入空回复，表示 key 不存在
+func (w *writer) null() {
+	w.WriteString("$-1\r\n")
+}
+
+// array 写入数组的长度，之后需要写入 n 个元素
+func (w *writer) array(n int) {
+	w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
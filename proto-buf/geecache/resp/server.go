@@ -0,0 +1,488 @@
+package resp
+
+import (
+	"Cache/proto-buf/geecache"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	maxArgs     = 1 << 20   // 单条命令最多的参数个数
+	maxBulkSize = 512 << 20 // 单个参数的最大长度，与 Redis 的 proto-max-bulk-len 默认值相同
+	maxInline   = 64 << 10  // inline 命令的最大长度
+
+	// 与 Redis 相同，认证之前只接受很小的命令，避免未认证的客户端让服务器分配大量内存
+	maxUnauthArgs     = 10       // 认证之前单条命令最多的参数个数
+	maxUnauthBulkSize = 16 << 10 // 认证之前单个参数的最大长度
+)
+
+// ErrServerClosed 在 Server 关闭后由 Serve 返回
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Config 是 RESP 服务器的配置
+type Config struct {
+	// DefaultGroup 是不带 "group:" 前缀的 key 所属的 Group，为空时这样的 key 返回错误。
+	// 前缀不是已注册 Group 的 key 也整体属于 DefaultGroup，
+	// 因此原本直接使用 Redis 的服务不需要修改 "session:abc" 这样的 key 就能切换过来
+	DefaultGroup string
+
+	// Auth 不为 nil 时客户端必须先发送 AUTH <token>，token 按 "Authorization: Bearer <token>" 交给 Auth 校验，
+	// 例如 geecache.TokenAuth。ACL 不为 nil 时按认证得到的身份检查每个 key 所属 group 的访问权限
+	Auth geecache.Authenticator
+	ACL  *geecache.ACL
+	Logf func(string, ...any) // 可选的日志函数
+}
+
+// Server 通过 RESP（Redis 序列化协议）对外提供 Group，支持 GET、MGET、SET、DEL、EXISTS、TTL、AUTH、PING 和 INFO。
+// key 的格式为 "group:key"，读取时调用 GetGroup(group).Get(key)，
+// 因此未命中的 key 同样会经过 singleflight、远程节点和 Getter 加载。
+// SET 和 DEL 只修改当前节点的缓存，不会写回数据源
+type Server struct {
+	cfg      Config
+	start    time.Time
+	commands atomic.Int64 // 已处理的命令数
+
+	mu        sync.Mutex // 保护以下字段
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup // 等待所有连接处理完毕
+}
+
+// NewServer 创建一个 RESP 服务器
+func NewServer(cfg Config) *Server {
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	return &Server{
+		cfg:       cfg,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe 监听 TCP 地址 addr 并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 接受 l 上的连接，每个连接由单独的 goroutine 处理。Close 后返回 ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭所有监听器和连接，并等待正在处理的命令完成
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// clients 返回当前的连接数
+func (s *Server) clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// serveConn 依次读取并执行连接上的命令，客户端流水线发送的多条命令在一次写入中返回
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+		s.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := &writer{bufio.NewWriter(conn)}
+	sess := &session{authed: s.cfg.Auth == nil}
+	for {
+		args, err := readCommand(r, sess.authed)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				w.error("ERR Protocol error: " + string(perr))
+				w.Flush()
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				s.cfg.Logf("[RESP] %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		s.commands.Add(1)
+		quit := s.exec(w, sess, args)
+		// 缓冲区中没有后续命令时才写出，流水线的多个回复合并为一次写入
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+// session 是一个连接的认证状态
+type session struct {
+	authed    bool   // 是否可以执行命令，没有配置 Auth 时总是为 true
+	principal string // AUTH 认证得到的身份
+}
+
+// exec 执行一条命令并写入回复，返回是否应该关闭连接
+func (s *Server) exec(w *writer, sess *session, args []string) bool {
+	name := strings.ToLower(args[0])
+	args = args[1:]
+	// 认证之前只能执行 AUTH 和 QUIT
+	if !sess.authed && name != "auth" && name != "quit" {
+		w.error("NOAUTH Authentication required.")
+		return false
+	}
+	switch name {
+	case "auth":
+		// 与 Redis 6 兼容，AUTH <username> <password> 中的 username 被忽略
+		if len(args) != 1 && len(args) != 2 {
+			w.arity(name)
+			return false
+		}
+		s.auth(w, sess, args[len(args)-1])
+	case "ping":
+		switch len(args) {
+		case 0:
+			w.status("PONG")
+		case 1:
+			w.bulk([]byte(args[0]))
+		default:
+			w.arity(name)
+		}
+	case "get":
+		if len(args) != 1 {
+			w.arity(name)
+			return false
+		}
+		s.get(w, sess, args[0])
+	case "mget":
+		if len(args) == 0 {
+			w.arity(name)
+			return false
+		}
+		s.mget(w, sess, args)
+	case "set":
+		if len(args) < 2 {
+			w.arity(name)
+			return false
+		}
+		s.set(w, sess, args)
+	case "del":
+		if len(args) == 0 {
+			w.arity(name)
+			return false
+		}
+		s.del(w, sess, args)
+	case "exists":
+		if len(args) == 0 {
+			w.arity(name)
+			return false
+		}
+		s.exists(w, sess, args)
+	case "ttl":
+		if len(args) != 1 {
+			w.arity(name)
+			return false
+		}
+		s.ttl(w, sess, args[0])
+	case "info":
+		s.info(w)
+	case "command":
+		w.array(0) // redis-cli 启动时会发送 COMMAND DOCS，返回空列表即可
+	case "quit":
+		w.status("OK")
+		return true
+	default:
+		w.error(fmt.Sprintf("ERR unknown command '%s'", truncate(name)))
+	}
+	return false
+}
+
+// truncate 截断过长的命令名，避免把客户端发来的大段数据写进错误信息
+func truncate(name string) string {
+	if len(name) > 64 {
+		return name[:64] + "..."
+	}
+	return name
+}
+
+// auth 处理 AUTH，认证失败后连接回到未认证的状态
+func (s *Server) auth(w *writer, sess *session, token string) {
+	if s.cfg.Auth == nil {
+		w.error("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+	r := &http.Request{Header: http.Header{"Authorization": {"Bearer " + token}}}
+	principal, err := s.cfg.Auth.Authenticate(r)
+	if err != nil {
+		sess.authed, sess.principal = false, ""
+		w.error("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	sess.authed, sess.principal = true, principal
+	w.status("OK")
+}
+
+// group 解析 "group:key" 形式的 key，返回对应的 Group 和组内的 key，并检查连接能否访问该 Group。
+// 设置了 DefaultGroup 时，前缀不是已注册 Group 的 key（例如 "session:abc"）整体属于 DefaultGroup
+func (s *Server) group(sess *session, key string) (*geecache.Group, string, error) {
+	name, k, ok := strings.Cut(key, ":")
+	g := geecache.GetGroup(name)
+	if !ok || (g == nil && s.cfg.DefaultGroup != "") {
+		if s.cfg.DefaultGroup == "" {
+			return nil, "", fmt.Errorf("ERR key %q is not of the form group:key", key)
+		}
+		name, k = s.cfg.DefaultGroup, key
+		g = geecache.GetGroup(name)
+	}
+	if g == nil {
+		return nil, "", fmt.Errorf("ERR no such group: %s", name)
+	}
+	if s.cfg.Auth != nil && s.cfg.ACL != nil && !s.cfg.ACL.Allowed(name, sess.principal) {
+		return nil, "", fmt.Errorf("NOPERM no permissions to access group %s", name)
+	}
+	return g, k, nil
+}
+
+// lookup 读取 key，不存在时返回的 ok 为 false
+func (s *Server) lookup(sess *session, key string) (v geecache.ByteView, ok bool, err error) {
+	g, k, err := s.group(sess, key)
+	if err != nil {
+		return geecache.ByteView{}, false, err
+	}
+	v, err = g.Get(k)
+	if errors.Is(err, geecache.ErrNotFound) {
+		return geecache.ByteView{}, false, nil
+	}
+	if err != nil {
+		return geecache.ByteView{}, false, fmt.Errorf("ERR %v", err)
+	}
+	return v, true, nil
+}
+
+// get 处理 GET key，不存在的 key 返回空回复
+func (s *Server) get(w *writer, sess *session, key string) {
+	v, ok, err := s.lookup(sess, key)
+	var b []byte
+	if err == nil && ok {
+		b, err = v.Bytes()
+	}
+	switch {
+	case err != nil:
+		w.error(err.Error())
+	case !ok:
+		w.null()
+	default:
+		w.bulk(b)
+	}
+}
+
+// mget 处理 MGET key [key ...]，同一个 Group 的 key 通过 GetMulti 一次读取。
+// 与 Redis 相同，读取失败的 key 返回空回复
+func (s *Server) mget(w *writer, sess *session, keys []string) {
+	type ref struct {
+		group *geecache.Group
+		key   string
+	}
+	refs := make([]ref, len(keys))
+	byGroup := make(map[*geecache.Group][]string)
+	for i, key := range keys {
+		g, k, err := s.group(sess, key)
+		if err != nil {
+			continue
+		}
+		refs[i] = ref{g, k}
+		byGroup[g] = append(byGroup[g], k)
+	}
+	results := make(map[*geecache.Group]map[string]geecache.Result, len(byGroup))
+	for g, ks := range byGroup {
+		results[g] = g.GetMulti(ks)
+	}
+
+	w.array(len(keys))
+	for _, r := range refs {
+		if r.group == nil {
+			w.null()
+			continue
+		}
+		res := results[r.group][r.key]
+		var b []byte
+		if res.Err == nil {
+			b, res.Err = res.Value.Bytes()
+		}
+		if res.Err != nil {
+			if !errors.Is(res.Err, geecache.ErrNotFound) {
+				s.cfg.Logf("[RESP] MGET %s:%s: %v", r.group.Name(), r.key, res.Err)
+			}
+			w.null()
+			continue
+		}
+		w.bulk(b)
+	}
+}
+
+// set 处理 SET key value [EX seconds | PX milliseconds]
+func (s *Server) set(w *writer, sess *session, args []string) {
+	var ttl time.Duration
+	for opts := args[2:]; len(opts) > 0; opts = opts[2:] {
+		unit := time.Duration(0)
+		switch strings.ToLower(opts[0]) {
+		case "ex":
+			unit = time.Second
+		case "px":
+			unit = time.Millisecond
+		}
+		if unit == 0 || len(opts) < 2 || ttl != 0 {
+			w.error("ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(opts[1], 10, 64)
+		if err != nil || n <= 0 || n > math.MaxInt64/int64(unit) {
+			w.error("ERR invalid expire time in 'set' command")
+			return
+		}
+		ttl = time.Duration(n) * unit
+	}
+
+	g, k, err := s.group(sess, args[0])
+	if err != nil {
+		w.error(err.Error())
+		return
+	}
+	if err := g.Set(k, []byte(args[1]), ttl); err != nil {
+		w.error("ERR " + err.Error())
+		return
+	}
+	w.status("OK")
+}
+
+// del 处理 DEL key [key ...]，返回从当前节点缓存中删除的 key 的个数
+func (s *Server) del(w *writer, sess *session, keys []string) {
+	n := 0
+	for _, key := range keys {
+		g, k, err := s.group(sess, key)
+		if err != nil {
+			w.error(err.Error())
+			return
+		}
+		if g.Remove(k) {
+			n++
+		}
+	}
+	w.integer(int64(n))
+}
+
+// exists 处理 EXISTS key [key ...]，返回能读取到的 key 的个数，重复的 key 重复计数
+func (s *Server) exists(w *writer, sess *session, keys []string) {
+	n := 0
+	for _, key := range keys {
+		_, ok, err := s.lookup(sess, key)
+		if err != nil {
+			w.error(err.Error())
+			return
+		}
+		if ok {
+			n++
+		}
+	}
+	w.integer(int64(n))
+}
+
+// ttl 处理 TTL key，返回剩余的秒数，没有过期时间时返回 -1，key 不存在时返回 -2
+func (s *Server) ttl(w *writer, sess *session, key string) {
+	v, ok, err := s.lookup(sess, key)
+	switch {
+	case err != nil:
+		w.error(err.Error())
+	case !ok:
+		w.integer(-2)
+	case v.Expire().IsZero():
+		w.integer(-1)
+	default:
+		w.integer(int64(math.Ceil(time.Until(v.Expire()).Seconds())))
+	}
+}
+
+// info 处理 INFO，返回服务器的基本信息
+func (s *Server) info(w *writer) {
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", int64(time.Since(s.start).Seconds()))
+	b.WriteString("# Clients\r\n")
+	fmt.Fprintf(&b, "connected_clients:%d\r\n", s.clients())
+	b.WriteString("# Stats\r\n")
+	fmt.Fprintf(&b, "total_commands_processed:%d\r\n", s.commands.Load())
+	if s.cfg.DefaultGroup != "" {
+		fmt.Fprintf(&b, "default_group:%s\r\n", s.cfg.DefaultGroup)
+	}
+	w.bulk([]byte(b.String()))
+}
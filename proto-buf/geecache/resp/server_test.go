@@ -0,0 +1,262 @@
+package resp
+
+import (
+	"Cache/proto-buf/geecache"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client 是一个最简单的 RESP 客户端，只用于测试
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// send 以 bulk string 数组的形式发送一条命令
+func (c *client) send(t *testing.T, args ...string) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reply 读取一条回复，简单字符串以 "+" 开头，错误以 "-" 开头，整数以 ":" 开头，
+// 空回复为 nil，数组转换为 []any
+func (c *client) reply(t *testing.T) any {
+	t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+', '-', ':':
+		return line
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]any, n)
+		for i := range items {
+			items[i] = c.reply(t)
+		}
+		return items
+	}
+	t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+func (c *client) do(t *testing.T, args ...string) any {
+	t.Helper()
+	c.send(t, args...)
+	return c.reply(t)
+}
+
+func TestServer(t *testing.T) {
+	loads := 0
+	g := geecache.NewGroup("resp-scores", 2<<10, geecache.GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			if key == "Tom" {
+				return []byte("630"), nil
+			}
+			return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+		}))
+	g.SetNegativeTTL(time.Minute)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{DefaultGroup: "resp-scores"})
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+
+	c := dial(t, l.Addr().String())
+	tests := []struct {
+		args []string
+		want any
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"ping", "hi"}, "hi"},
+		{[]string{"GET", "resp-scores:Tom"}, "630"},
+		{[]string{"GET", "Tom"}, "630"}, // 使用 DefaultGroup
+		{[]string{"GET", "resp-scores:kkk"}, nil},
+		{[]string{"GET", "unknown:Tom"}, nil}, // 前缀不是 group，整个 key 属于 DefaultGroup
+		{[]string{"SET", "session:abc", "1"}, "+OK"},
+		{[]string{"GET", "session:abc"}, "1"},
+		{[]string{"GET", "resp-scores:session:abc"}, "1"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command"},
+		{[]string{"TTL", "resp-scores:Tom"}, ":-1"},
+		{[]string{"TTL", "resp-scores:kkk"}, ":-2"},
+		{[]string{"SET", "resp-scores:Sam", "567", "EX", "100"}, "+OK"},
+		{[]string{"TTL", "resp-scores:Sam"}, ":100"},
+		{[]string{"SET", "resp-scores:Sam", "567", "EX", "0"}, "-ERR invalid expire time in 'set' command"},
+		{[]string{"SET", "resp-scores:Sam", "567", "NX"}, "-ERR syntax error"},
+		{[]string{"MGET", "resp-scores:Tom", "resp-scores:kkk", "Sam", "unknown:x"}, []any{"630", nil, "567", nil}},
+		{[]string{"EXISTS", "resp-scores:Tom", "resp-scores:kkk", "resp-scores:Tom"}, ":2"},
+		{[]string{"DEL", "resp-scores:Sam", "resp-scores:nothing"}, ":1"},
+		{[]string{"GET", "resp-scores:Sam"}, nil},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'flushall'"},
+	}
+	for _, tt := range tests {
+		got := c.do(t, tt.args...)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+	if loads != 5 { // Tom、kkk、unknown:Tom、unknown:x 和删除后的 Sam 各加载一次
+		t.Errorf("getter called %d times, want 5", loads)
+	}
+
+	info, _ := c.do(t, "INFO").(string)
+	if !strings.Contains(info, "connected_clients:1\r\n") {
+		t.Errorf("INFO = %q, want connected_clients:1", info)
+	}
+
+	t.Run("without default group", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewServer(Config{Logf: t.Logf})
+		go s.Serve(l)
+		defer s.Close()
+		c := dial(t, l.Addr().String())
+		if got := c.do(t, "GET", "unknown:Tom"); got != "-ERR no such group: unknown" {
+			t.Errorf("GET unknown:Tom = %q", got)
+		}
+		if got := c.do(t, "GET", "Tom"); got != `-ERR key "Tom" is not of the form group:key` {
+			t.Errorf("GET Tom = %q", got)
+		}
+	})
+
+	t.Run("pipeline", func(t *testing.T) {
+		c := dial(t, l.Addr().String())
+		// 一次写入多条命令，再依次读取回复
+		c.send(t, "SET", "resp-scores:a", "1")
+		c.send(t, "SET", "resp-scores:b", "2")
+		c.send(t, "MGET", "resp-scores:a", "resp-scores:b")
+		for _, want := range []string{"+OK", "+OK", "[1 2]"} {
+			if got := fmt.Sprint(c.reply(t)); got != want {
+				t.Errorf("reply = %q, want %q", got, want)
+			}
+		}
+	})
+
+	t.Run("inline", func(t *testing.T) {
+		c := dial(t, l.Addr().String())
+		io.WriteString(c.conn, "PING\r\nGET resp-scores:Tom\r\n")
+		if got := c.reply(t); got != "+PONG" {
+			t.Errorf("PING = %q", got)
+		}
+		if got := c.reply(t); got != "630" {
+			t.Errorf("GET = %q", got)
+		}
+	})
+
+	t.Run("protocol error", func(t *testing.T) {
+		c := dial(t, l.Addr().String())
+		io.WriteString(c.conn, "*1\r\n+PING\r\n")
+		if got, _ := c.reply(t).(string); !strings.HasPrefix(got, "-ERR Protocol error") {
+			t.Errorf("reply = %q, want protocol error", got)
+		}
+		if _, err := c.r.ReadByte(); err != io.EOF {
+			t.Errorf("connection not closed after protocol error: %v", err)
+		}
+	})
+
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve returned %v, want ErrServerClosed", err)
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	getter := geecache.GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	})
+	geecache.NewGroup("resp-alice", 2<<10, getter)
+	geecache.NewGroup("resp-bob", 2<<10, getter)
+	acl := geecache.NewACL()
+	acl.Allow("resp-alice", "alice")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Config{
+		DefaultGroup: "resp-alice",
+		Auth:         geecache.TokenAuth{"t1": "alice"},
+		ACL:          acl,
+		Logf:         t.Logf,
+	})
+	go s.Serve(l)
+	defer s.Close()
+
+	c := dial(t, l.Addr().String())
+	for _, tt := range []struct {
+		args []string
+		want any
+	}{
+		{[]string{"GET", "Tom"}, "-NOAUTH Authentication required."},
+		{[]string{"PING"}, "-NOAUTH Authentication required."},
+		{[]string{"AUTH", "wrong"}, "-WRONGPASS invalid username-password pair or user is disabled."},
+		{[]string{"AUTH", "default", "t1"}, "+OK"},
+		{[]string{"GET", "Tom"}, "v-Tom"},
+		{[]string{"GET", "resp-bob:Tom"}, "-NOPERM no permissions to access group resp-bob"},
+		{[]string{"SET", "resp-bob:Tom", "1"}, "-NOPERM no permissions to access group resp-bob"},
+		{[]string{"MGET", "resp-alice:Tom", "resp-bob:Tom"}, []any{"v-Tom", nil}},
+	} {
+		if got := c.do(t, tt.args...); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v = %#v, want %#v", tt.args, got, tt.want)
+		}
+	}
+
+	// 认证之前不接受大的命令，声明的长度超过限制时直接断开连接，不按声明的长度分配内存
+	for _, header := range []string{"*1\r\n$536870912\r\n", "*1048576\r\n"} {
+		c := dial(t, l.Addr().String())
+		io.WriteString(c.conn, header)
+		if got := c.reply(t); !strings.HasPrefix(fmt.Sprint(got), "-ERR Protocol error: invalid") {
+			t.Errorf("%q before AUTH = %#v, want a protocol error", header, got)
+		}
+		if _, err := c.r.ReadByte(); err != io.EOF {
+			t.Errorf("%q before AUTH: connection is not closed: %v", header, err)
+		}
+	}
+	c = dial(t, l.Addr().String())
+	c.do(t, "AUTH", "t1")
+	if got := c.do(t, "SET", "big", strings.Repeat("x", 64<<10)); got != "+OK" {
+		t.Errorf("SET of a 64KB value after AUTH = %#v, want +OK", got)
+	}
+}
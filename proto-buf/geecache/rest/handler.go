@@ -0,0 +1,411 @@
+// Package rest 通过 REST 风格的 HTTP API 对外提供 Group：
+//
+//	GET    /v1/groups                    列出调用方可以访问的 group 及其统计信息
+//	POST   /v1/groups                    创建 group，请求体为 GroupSpec
+//	GET    /v1/groups/{group}            group 的统计信息
+//	GET    /v1/groups/{group}/keys/{key} 读取 value，支持 If-None-Match
+//	PUT    /v1/groups/{group}/keys/{key} 写入 value，记录请求的 Content-Type，可以带 ttl=30s
+//	DELETE /v1/groups/{group}/keys/{key} 从当前节点的缓存中删除 key
+//	POST   /v1/groups/{group}/mget       批量读取，请求体为 {"keys": [...]}
+//
+// 读取时未命中的 key 同样会经过 singleflight、远程节点和 Getter 加载；
+// 写入和删除只修改当前节点的缓存，不会写回数据源。
+// 出错时响应体为 {"code": "not_found", "message": "..."}，code 与节点之间的错误码相同
+package rest
+
+import (
+	"Cache/proto-buf/geecache"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxValueBytes = 64 << 20 // PUT 请求中 value 的默认最大长度
+	maxMGetKeys          = 10000    // 一次 mget 最多的 key 数
+	maxSpecBytes         = 64 << 10 // 创建 group 的请求体的最大长度
+)
+
+// Config 是 REST API 的配置
+type Config struct {
+	Auth geecache.Authenticator // 认证请求，为 nil 时不做认证
+	ACL  *geecache.ACL          // 各 group 允许访问的身份，为 nil 时不限制；创建 group 需要 "*" 的权限
+
+	// NewGetter 为通过 API 创建的 group 提供数据源，为 nil 时新 group 没有数据源，只包含写入的 value。
+	// 通过 API 创建的 group 只存在于当前节点，不注册节点池
+	NewGetter func(spec GroupSpec) (geecache.Getter, error)
+
+	MaxValueBytes int64                // PUT 请求中 value 的最大长度，默认为 64MB
+	Logf          func(string, ...any) // 可选的日志函数
+}
+
+// GroupSpec 是创建 group 的请求体
+type GroupSpec struct {
+	Name        string `json:"name"`
+	CacheBytes  int64  `json:"cacheBytes"`            // 缓存的最大字节数
+	TTL         string `json:"ttl,omitempty"`         // value 的有效期，例如 "10m"，为空时不过期
+	NegativeTTL string `json:"negativeTTL,omitempty"` // 不存在的 key 的缓存时间，为空时不缓存
+}
+
+// GroupList 是 GET /v1/groups 的响应
+type GroupList struct {
+	Groups []geecache.GroupStats `json:"groups"`
+}
+
+// MGetRequest 是 mget 的请求体
+type MGetRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// MGetResult 是 mget 中单个 key 的结果，Error 不为 nil 时其他字段无效
+type MGetResult struct {
+	Key         string `json:"key"`
+	Value       []byte `json:"value,omitempty"` // JSON 中为 base64 编码
+	ContentType string `json:"contentType,omitempty"`
+	ETag        string `json:"etag,omitempty"`
+	Expire      int64  `json:"expire,omitempty"` // 过期时间，Unix 毫秒时间戳，0 表示不过期
+	Error       *Error `json:"error,omitempty"`
+}
+
+// MGetResponse 是 mget 的响应，Results 与请求中的 keys 一一对应
+type MGetResponse struct {
+	Results []MGetResult `json:"results"`
+}
+
+// Error 是出错时的响应体
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errNoGetter 是没有数据源的 group 加载未写入的 key 时返回的错误
+var errNoGetter = geecache.GetterFunc(func(key string) ([]byte, error) {
+	return nil, fmt.Errorf("%s has not been set: %w", key, geecache.ErrNotFound)
+})
+
+type handler struct {
+	cfg      Config
+	mux      *http.ServeMux
+	createMu sync.Mutex // 串行化 group 的创建，避免同名 group 互相覆盖
+}
+
+// NewHandler 返回 REST API 的 http.Handler，通常挂载在 "/v1/" 下
+func NewHandler(cfg Config) http.Handler {
+	if cfg.MaxValueBytes <= 0 {
+		cfg.MaxValueBytes = defaultMaxValueBytes
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	h := &handler{cfg: cfg, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/v1/groups", h.serveGroups)
+	h.mux.HandleFunc("/v1/groups/{group}", h.serveGroup)
+	h.mux.HandleFunc("/v1/groups/{group}/keys/{key...}", h.serveKey)
+	h.mux.HandleFunc("/v1/groups/{group}/mget", h.serveMGet)
+	h.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "no such endpoint: "+r.URL.Path)
+	})
+	return h
+}
+
+// ServeHTTP 实现了 http.Handler 接口
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorize 认证请求并检查调用方能否访问 group，失败时写入错误
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request, group string) (principal string, ok bool) {
+	principal, err := geecache.Authorize(h.cfg.Auth, h.cfg.ACL, r, group)
+	if err != nil {
+		writeErr(w, err)
+		return "", false
+	}
+	return principal, true
+}
+
+// group 授权后返回路径中的 group，失败时写入错误
+func (h *handler) group(w http.ResponseWriter, r *http.Request) (*geecache.Group, bool) {
+	name := r.PathValue("group")
+	if _, ok := h.authorize(w, r, name); !ok {
+		return nil, false
+	}
+	g := geecache.GetGroup(name)
+	if g == nil {
+		writeErr(w, fmt.Errorf("%w: %s", geecache.ErrNoSuchGroup, name))
+		return nil, false
+	}
+	return g, true
+}
+
+// serveGroups 列出和创建 group
+func (h *handler) serveGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		// 只做认证，调用方只能看到自己可以访问的 group
+		principal, err := geecache.Authorize(h.cfg.Auth, nil, r, "")
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		res := GroupList{Groups: []geecache.GroupStats{}}
+		for _, name := range geecache.GroupNames() {
+			if h.cfg.Auth != nil && h.cfg.ACL != nil && principal != geecache.PeerPrincipal && !h.cfg.ACL.Allowed(name, principal) {
+				continue
+			}
+			if g := geecache.GetGroup(name); g != nil {
+				res.Groups = append(res.Groups, g.Stats())
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+	case http.MethodPost:
+		if _, ok := h.authorize(w, r, "*"); !ok {
+			return
+		}
+		h.createGroup(w, r)
+	default:
+		methodNotAllowed(w, "GET, POST")
+	}
+}
+
+// createGroup 按请求体创建 group，同名的 group 已经存在时返回 409
+func (h *handler) createGroup(w http.ResponseWriter, r *http.Request) {
+	var spec GroupSpec
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxSpecBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		writeErr(w, fmt.Errorf("%w: decoding request body: %v", geecache.ErrBadRequest, err))
+		return
+	}
+	ttl, negativeTTL, err := spec.validate()
+	if err != nil {
+		writeErr(w, fmt.Errorf("%w: %v", geecache.ErrBadRequest, err))
+		return
+	}
+	getter := geecache.Getter(errNoGetter)
+	if h.cfg.NewGetter != nil {
+		if getter, err = h.cfg.NewGetter(spec); err != nil {
+			writeErr(w, fmt.Errorf("%w: %v", geecache.ErrBadRequest, err))
+			return
+		}
+	}
+
+	h.createMu.Lock()
+	defer h.createMu.Unlock()
+	if geecache.GetGroup(spec.Name) != nil {
+		writeError(w, http.StatusConflict, "conflict", "group already exists: "+spec.Name)
+		return
+	}
+	g := geecache.NewGroup(spec.Name, spec.CacheBytes, getter)
+	g.SetTTL(ttl)
+	g.SetNegativeTTL(negativeTTL)
+	h.cfg.Logf("[REST] created group %s (%d bytes)", spec.Name, spec.CacheBytes)
+	w.Header().Set("Location", "/v1/groups/"+url.PathEscape(spec.Name))
+	writeJSON(w, http.StatusCreated, g.Stats())
+}
+
+// validate 校验创建 group 的请求并解析其中的时间间隔
+func (s GroupSpec) validate() (ttl, negativeTTL time.Duration, err error) {
+	switch {
+	case s.Name == "":
+		return 0, 0, errors.New("name is required")
+	case s.Name == "*" || strings.Contains(s.Name, "/"):
+		return 0, 0, fmt.Errorf("invalid group name %q", s.Name)
+	case s.CacheBytes <= 0:
+		return 0, 0, errors.New("cacheBytes must be positive")
+	}
+	if s.TTL != "" {
+		if ttl, err = time.ParseDuration(s.TTL); err != nil || ttl < 0 {
+			return 0, 0, fmt.Errorf("invalid ttl %q", s.TTL)
+		}
+	}
+	if s.NegativeTTL != "" {
+		if negativeTTL, err = time.ParseDuration(s.NegativeTTL); err != nil || negativeTTL < 0 {
+			return 0, 0, fmt.Errorf("invalid negativeTTL %q", s.NegativeTTL)
+		}
+	}
+	return ttl, negativeTTL, nil
+}
+
+// serveGroup 返回 group 的统计信息
+func (h *handler) serveGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		methodNotAllowed(w, "GET")
+		return
+	}
+	if g, ok := h.group(w, r); ok {
+		writeJSON(w, http.StatusOK, g.Stats())
+	}
+}
+
+// serveKey 处理对单个 key 的读取、写入和删除
+func (h *handler) serveKey(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+	default:
+		methodNotAllowed(w, "GET, PUT, DELETE")
+		return
+	}
+	g, ok := h.group(w, r)
+	if !ok {
+		return
+	}
+	key := r.PathValue("key")
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		view, err := g.Get(key)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		etag := etagOf(view)
+		w.Header().Set("ETag", etag)
+		if etagMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		b, err := view.Bytes()
+		if err != nil {
+			w.Header().Del("ETag")
+			writeErr(w, err)
+			return
+		}
+		contentType := view.ContentType()
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", contentType)
+		if !view.Expire().IsZero() {
+			w.Header().Set("Expires", view.Expire().UTC().Format(http.TimeFormat))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		if r.Method == http.MethodGet {
+			w.Write(b)
+		}
+	case http.MethodPut:
+		var ttl time.Duration
+		if v := r.URL.Query().Get("ttl"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				writeErr(w, fmt.Errorf("%w: invalid ttl %q", geecache.ErrBadRequest, v))
+				return
+			}
+			ttl = d
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxValueBytes+1))
+		if err != nil {
+			writeErr(w, fmt.Errorf("%w: reading request body: %v", geecache.ErrBadRequest, err))
+			return
+		}
+		if int64(len(body)) > h.cfg.MaxValueBytes {
+			writeError(w, http.StatusRequestEntityTooLarge, "too_large",
+				fmt.Sprintf("value exceeds %d bytes", h.cfg.MaxValueBytes))
+			return
+		}
+		if err := g.SetWithContentType(key, body, r.Header.Get("Content-Type"), ttl); err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !g.Remove(key) {
+			writeErr(w, fmt.Errorf("%w: %s is not cached", geecache.ErrNotFound, key))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// serveMGet 批量读取 group 中的 key，未命中的 key 按负责的节点分组加载
+func (h *handler) serveMGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, "POST")
+		return
+	}
+	g, ok := h.group(w, r)
+	if !ok {
+		return
+	}
+	var req MGetRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, h.cfg.MaxValueBytes)).Decode(&req); err != nil {
+		writeErr(w, fmt.Errorf("%w: decoding request body: %v", geecache.ErrBadRequest, err))
+		return
+	}
+	if len(req.Keys) > maxMGetKeys {
+		writeErr(w, fmt.Errorf("%w: at most %d keys per request", geecache.ErrBadRequest, maxMGetKeys))
+		return
+	}
+	results := g.GetMulti(req.Keys)
+	res := MGetResponse{Results: make([]MGetResult, len(req.Keys))}
+	for i, key := range req.Keys {
+		r := results[key]
+		var b []byte
+		if r.Err == nil {
+			b, r.Err = r.Value.Bytes()
+		}
+		if r.Err != nil {
+			res.Results[i] = MGetResult{Key: key, Error: &Error{Code: geecache.ErrorCode(r.Err), Message: r.Err.Error()}}
+			continue
+		}
+		res.Results[i] = MGetResult{
+			Key:         key,
+			Value:       b,
+			ContentType: r.Value.ContentType(),
+			ETag:        etagOf(r.Value),
+		}
+		if expire := r.Value.Expire(); !expire.IsZero() {
+			res.Results[i].Expire = expire.UnixMilli()
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// etagOf 以 value 的版本作为 ETag，value 更新后版本随之变化
+func etagOf(v geecache.ByteView) string {
+	return `"` + strconv.FormatUint(v.Version(), 16) + `"`
+}
+
+// etagMatch 判断 If-None-Match 中是否包含 etag，按 RFC 9110 使用弱比较
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON 以 JSON 格式写入响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入 JSON 格式的错误
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, Error{Code: code, Message: message})
+}
+
+// writeErr 按 err 的类型写入错误
+func writeErr(w http.ResponseWriter, err error) {
+	writeError(w, geecache.HTTPStatus(err), geecache.ErrorCode(err), err.Error())
+}
+
+// methodNotAllowed 写入 405 错误
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed, use "+allow)
+}
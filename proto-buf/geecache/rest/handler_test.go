@@ -0,0 +1,162 @@
+package rest
+
+import (
+	"Cache/proto-buf/geecache"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// do 发送请求，返回状态码、响应头和响应体
+func do(t *testing.T, method, url, body string, header http.Header) (int, http.Header, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(res.Body)
+	return res.StatusCode, res.Header, string(b)
+}
+
+func TestHandler(t *testing.T) {
+	g := geecache.NewGroup("rest-scores", 2<<10, geecache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "kkk" {
+			return nil, fmt.Errorf("%s: %w", key, geecache.ErrNotFound)
+		}
+		return []byte("630"), nil
+	}))
+	g.SetNegativeTTL(time.Minute)
+	srv := httptest.NewServer(NewHandler(Config{Logf: t.Logf}))
+	defer srv.Close()
+	base := srv.URL + "/v1/groups/rest-scores"
+
+	// 从数据源加载的 value，带有 ETag
+	code, h, body := do(t, "GET", base+"/keys/Tom", "", nil)
+	if code != http.StatusOK || body != "630" || h.Get("Content-Type") != "application/octet-stream" || h.Get("ETag") == "" {
+		t.Fatalf("GET Tom = %d %q %v", code, body, h)
+	}
+	etag := h.Get("ETag")
+	if code, _, body = do(t, "GET", base+"/keys/Tom", "", http.Header{"If-None-Match": {`"x", ` + etag}}); code != http.StatusNotModified || body != "" {
+		t.Errorf("GET Tom with If-None-Match = %d %q, want 304", code, body)
+	}
+
+	// 写入时的 Content-Type 原样返回，写入后 ETag 变化
+	if code, _, body = do(t, "PUT", base+"/keys/Tom?ttl=1m", `{"score":630}`, http.Header{"Content-Type": {"application/json"}}); code != http.StatusNoContent {
+		t.Fatalf("PUT Tom = %d %q", code, body)
+	}
+	code, h, body = do(t, "GET", base+"/keys/Tom", "", http.Header{"If-None-Match": {etag}})
+	if code != http.StatusOK || body != `{"score":630}` || h.Get("Content-Type") != "application/json" || h.Get("ETag") == etag || h.Get("Expires") == "" {
+		t.Errorf("GET Tom after PUT = %d %q %v", code, body, h)
+	}
+	// key 中可以包含 "/"
+	if code, _, _ = do(t, "PUT", base+"/keys/a/b", "ab", nil); code != http.StatusNoContent {
+		t.Errorf("PUT a/b = %d", code)
+	}
+	if code, _, body = do(t, "GET", base+"/keys/a/b", "", nil); code != http.StatusOK || body != "ab" {
+		t.Errorf("GET a/b = %d %q", code, body)
+	}
+
+	code, _, body = do(t, "POST", base+"/mget", `{"keys": ["Tom", "kkk", "Jack"]}`, nil)
+	var mget MGetResponse
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &mget) != nil || len(mget.Results) != 3 {
+		t.Fatalf("mget = %d %q", code, body)
+	}
+	if r := mget.Results[0]; r.Key != "Tom" || string(r.Value) != `{"score":630}` || r.ContentType != "application/json" || r.Expire == 0 {
+		t.Errorf("mget Tom = %+v", r)
+	}
+	if r := mget.Results[1]; r.Error == nil || r.Error.Code != "not_found" {
+		t.Errorf("mget kkk = %+v", r)
+	}
+	if r := mget.Results[2]; r.Error != nil || string(r.Value) != "630" {
+		t.Errorf("mget Jack = %+v", r)
+	}
+
+	if code, _, _ = do(t, "DELETE", base+"/keys/Tom", "", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE Tom = %d", code)
+	}
+	// 出错时返回 JSON 格式的错误
+	for _, tt := range []struct {
+		method, url, body string
+		status            int
+		code              string
+	}{
+		{"DELETE", base + "/keys/Tom", "", http.StatusNotFound, "not_found"},
+		{"GET", base + "/keys/kkk", "", http.StatusNotFound, "not_found"},
+		{"GET", srv.URL + "/v1/groups/nope/keys/Tom", "", http.StatusNotFound, "no_such_group"},
+		{"PUT", base + "/keys/Tom?ttl=soon", "", http.StatusBadRequest, "bad_request"},
+		{"PATCH", base + "/keys/Tom", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+		{"POST", base + "/mget", "[", http.StatusBadRequest, "bad_request"},
+		{"GET", srv.URL + "/v1/nope", "", http.StatusNotFound, "not_found"},
+	} {
+		code, h, body := do(t, tt.method, tt.url, tt.body, nil)
+		var e Error
+		if code != tt.status || h.Get("Content-Type") != "application/json" || json.Unmarshal([]byte(body), &e) != nil || e.Code != tt.code {
+			t.Errorf("%s %s = %d %q, want %d %s", tt.method, tt.url, code, body, tt.status, tt.code)
+		}
+	}
+}
+
+func TestCreateGroup(t *testing.T) {
+	acl := geecache.NewACL()
+	acl.Allow("*", "admin")
+	acl.Allow("rest-visible", "alice")
+	srv := httptest.NewServer(NewHandler(Config{
+		Auth: geecache.TokenAuth{"t1": "admin", "t2": "alice"},
+		ACL:  acl,
+		Logf: t.Logf,
+	}))
+	defer srv.Close()
+	admin := http.Header{"Authorization": {"Bearer t1"}}
+	alice := http.Header{"Authorization": {"Bearer t2"}}
+
+	spec := `{"name": "rest-visible", "cacheBytes": 1024, "ttl": "1m"}`
+	if code, _, body := do(t, "POST", srv.URL+"/v1/groups", spec, alice); code != http.StatusForbidden {
+		t.Errorf("create as alice = %d %q, want 403", code, body)
+	}
+	code, h, body := do(t, "POST", srv.URL+"/v1/groups", spec, admin)
+	if code != http.StatusCreated || h.Get("Location") != "/v1/groups/rest-visible" {
+		t.Fatalf("create = %d %q", code, body)
+	}
+	if code, _, _ := do(t, "POST", srv.URL+"/v1/groups", spec, admin); code != http.StatusConflict {
+		t.Errorf("create again = %d, want 409", code)
+	}
+	if code, _, _ := do(t, "POST", srv.URL+"/v1/groups", `{"name": "rest-hidden", "cacheBytes": 1024}`, admin); code != http.StatusCreated {
+		t.Errorf("create rest-hidden = %d", code)
+	}
+	if code, _, body := do(t, "POST", srv.URL+"/v1/groups", `{"name": "x"}`, admin); code != http.StatusBadRequest {
+		t.Errorf("create without cacheBytes = %d %q, want 400", code, body)
+	}
+
+	// 新 group 没有数据源，只能读到写入的 value
+	keyURL := srv.URL + "/v1/groups/rest-visible/keys/Tom"
+	if code, _, _ := do(t, "GET", keyURL, "", alice); code != http.StatusNotFound {
+		t.Errorf("GET before PUT = %d, want 404", code)
+	}
+	do(t, "PUT", keyURL, "630", alice)
+	if code, _, body := do(t, "GET", keyURL, "", alice); code != http.StatusOK || body != "630" {
+		t.Errorf("GET after PUT = %d %q", code, body)
+	}
+
+	// 列表只包含调用方可以访问的 group
+	var list GroupList
+	_, _, body = do(t, "GET", srv.URL+"/v1/groups", "", alice)
+	if err := json.Unmarshal([]byte(body), &list); err != nil || len(list.Groups) != 1 || list.Groups[0].Name != "rest-visible" {
+		t.Errorf("list as alice = %q", body)
+	}
+	if code, _, _ := do(t, "GET", srv.URL+"/v1/groups", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("list without token = %d, want 401", code)
+	}
+}
@@ -0,0 +1,67 @@
+package geecache
+
+import (
+	"Cache/proto-buf/geecache/consistenthash"
+	"sync/atomic"
+)
+
+// GroupStats 是 Group 在当前节点上的统计信息
+type GroupStats struct {
+	Name       string `json:"name"`
+	Gets       int64  `json:"gets"`       // 读取的 key 数，包括 GetMulti 中的每个 key
+	Hits       int64  `json:"hits"`       // 命中当前节点缓存的次数
+	PeerLoads  int64  `json:"peerLoads"`  // 从远程节点获取成功的次数
+	LocalLoads int64  `json:"localLoads"` // 从数据源加载的次数
+	Items      int    `json:"items"`      // 缓存中的条目数
+	Bytes      int64  `json:"bytes"`      // 缓存占用的字节数
+	CacheBytes int64  `json:"cacheBytes"` // 缓存的最大字节数
+}
+
+// groupCounters 是 Group 的计数器
+type groupCounters struct {
+	gets       atomic.Int64
+	hits       atomic.Int64
+	peerLoads  atomic.Int64
+	localLoads atomic.Int64
+}
+
+// Stats 返回 Group 在当前节点上的统计信息
+func (g *Group) Stats() GroupStats {
+	items, bytes := g.mainCache.stats()
+	return GroupStats{
+		Name:       g.name,
+		Gets:       g.counters.gets.Load(),
+		Hits:       g.counters.hits.Load(),
+		PeerLoads:  g.counters.peerLoads.Load(),
+		LocalLoads: g.counters.localLoads.Load(),
+		Items:      items,
+		Bytes:      bytes,
+		CacheBytes: g.mainCache.cacheBytes,
+	}
+}
+
+// Keys 返回当前节点缓存中至多 limit 个 key，按最近访问的顺序排列，limit 小于等于 0 时返回全部
+func (g *Group) Keys(limit int) []string {
+	return g.mainCache.keys(limit)
+}
+
+// Ring 返回当前的哈希环，调用方不能修改它
+func (p *HTTPPool) Ring() *consistenthash.Map {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers
+}
+
+// Ring 返回当前的哈希环，调用方不能修改它
+func (p *GRPCPool) Ring() *consistenthash.Map {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers
+}
+
+// Ring 返回当前的哈希环，调用方不能修改它
+func (p *TCPPool) Ring() *consistenthash.Map {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers
+}
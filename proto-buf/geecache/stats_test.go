@@ -0,0 +1,48 @@
+package geecache
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupStats(t *testing.T) {
+	g := NewGroup("stats-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "kkk" {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return []byte("630"), nil
+	}))
+	g.SetNegativeTTL(time.Minute)
+	for _, key := range []string{"Tom", "Tom", "Jack", "kkk", "kkk"} {
+		g.Get(key)
+	}
+	g.Set("Sam", []byte("567"), time.Nanosecond) // 立即过期，不出现在 Keys 中
+	time.Sleep(time.Millisecond)
+
+	s := g.Stats()
+	want := GroupStats{Name: "stats-scores", Gets: 5, Hits: 2, LocalLoads: 3, Items: 4, Bytes: s.Bytes, CacheBytes: 2 << 10}
+	if s != want || s.Bytes == 0 {
+		t.Errorf("Stats() = %+v, want %+v", s, want)
+	}
+	// 按最近访问的顺序排列，不存在的结果不包括在内
+	if keys := g.Keys(0); !reflect.DeepEqual(keys, []string{"Jack", "Tom"}) {
+		t.Errorf("Keys(0) = %v", keys)
+	}
+	if keys := g.Keys(1); !reflect.DeepEqual(keys, []string{"Jack"}) {
+		t.Errorf("Keys(1) = %v", keys)
+	}
+
+	p := NewHTTPPool("http://a")
+	p.Set("http://a", "http://b", "http://c")
+	shares := p.Ring().Shares()
+	sum := 0.0
+	for _, share := range shares {
+		sum += share
+	}
+	if len(shares) != 3 || math.Abs(sum-1) > 1e-9 {
+		t.Errorf("Shares() = %v, want 3 nodes summing to 1", shares)
+	}
+}
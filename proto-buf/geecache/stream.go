@@ -0,0 +1,216 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultStreamThreshold = 1 << 20  // 默认超过 1MB 的 value 分块传输
+	streamChunkSize        = 64 << 10 // 每一块的大小
+
+	// streamHeader 出现在请求中表示请求方可以接收分块传输的响应，出现在响应中表示响应体是分块传输的原始 value
+	streamHeader   = "X-Geecache-Stream"
+	sizeHeader     = "X-Geecache-Size"     // value 的总长度
+	checksumHeader = "X-Geecache-Checksum" // value 的 CRC-32C 校验和
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum 计算 value 的 CRC-32C 校验和
+func checksum(b []byte) uint32 {
+	return crc32.Checksum(b, crc32c)
+}
+
+// WithStreamThreshold 设置分块传输的阈值，超过 n 字节的 value 不再编码为 pb.Response，
+// 而是以 chunked 响应体直接发送，请求方边读边写入预先分配好的缓冲区。n 为 0 时不分块传输
+func WithStreamThreshold(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.streamThreshold = n
+	}
+}
+
+// shouldStream 判断是否以分块传输的方式返回 view
+func (p *HTTPPool) shouldStream(r *http.Request, view ByteView) bool {
+	return p.streamThreshold > 0 && view.Len() > p.streamThreshold && r.Header.Get(streamHeader) != ""
+}
+
+// writeStream 把 value 分块写入响应体，每写一块就发送出去，不在内存中再复制一份
+func writeStream(w http.ResponseWriter, r *http.Request, view ByteView) {
+	b, encoding, err := wireValue(view, r.Header.Get(acceptEncodingHeader))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set(streamHeader, "1")
+	if encoding != "" {
+		w.Header().Set(encodingHeader, encoding)
+	}
+	if !view.expire.IsZero() {
+		w.Header().Set(expireHeader, strconv.FormatInt(unixMilli(view.expire), 10))
+	}
+	w.Header().Set(versionHeader, strconv.FormatUint(view.version, 10))
+	if view.contentType != "" {
+		w.Header().Set(contentTypeHeader, view.contentType)
+	}
+	if view.flags != 0 {
+		w.Header().Set(flagsHeader, strconv.FormatUint(uint64(view.flags), 10))
+	}
+	w.Header().Set(sizeHeader, strconv.Itoa(len(b)))
+	w.Header().Set(checksumHeader, strconv.FormatUint(uint64(checksum(b)), 10))
+	flusher, _ := w.(http.Flusher)
+	for off := 0; off < len(b); off += streamChunkSize {
+		end := off + streamChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		if _, err := w.Write(b[off:end]); err != nil {
+			return // 请求方已经断开
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// readStream 读取分块传输的响应体并校验长度和校验和
+func readStream(res *http.Response, limit int64) ([]byte, error) {
+	size, err := strconv.ParseInt(res.Header.Get(sizeHeader), 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid %s header: %q", sizeHeader, res.Header.Get(sizeHeader))
+	}
+	if size > limit {
+		return nil, fmt.Errorf("response body exceeds %d bytes", limit)
+	}
+	want, err := strconv.ParseUint(res.Header.Get(checksumHeader), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %q", checksumHeader, res.Header.Get(checksumHeader))
+	}
+
+	// 按声明的长度一次分配，避免边读边扩容带来的多次拷贝
+	buf := make([]byte, size)
+	if _, err = io.ReadFull(res.Body, buf); err != nil {
+		return nil, fmt.Errorf("reading streamed value: %v", err)
+	}
+	if n, _ := res.Body.Read(make([]byte, 1)); n > 0 {
+		return nil, fmt.Errorf("streamed value is longer than %d bytes", size)
+	}
+	if got := checksum(buf); got != uint32(want) {
+		return nil, fmt.Errorf("checksum mismatch: got %08x, want %08x", got, want)
+	}
+	return buf, nil
+}
+
+// SetStreamThreshold 设置 GetStream 分块的阈值，不超过 n 字节的 value 只发送一块。
+// n 不应超过 gRPC 的最大消息大小（默认 4MB）
+func (p *GRPCPool) SetStreamThreshold(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.streamThreshold = n
+}
+
+// GetStream 实现了 GroupCache 服务，把 value 分块发送给其他节点，
+// 不受 gRPC 单条消息大小的限制
+func (p *GRPCPool) GetStream(in *pb.Request, stream pb.GroupCache_GetStreamServer) error {
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return grpcError(fmt.Errorf("%w: %s", ErrNoSuchGroup, in.GetGroup()))
+	}
+	view, err := peerLookup(group, in.GetKey(), false, incomingAcceptNotFound(stream.Context()))
+	if err != nil {
+		return grpcError(err)
+	}
+	group.stats.hit(in.GetKey())
+
+	p.mu.Lock()
+	chunkSize := p.streamThreshold
+	p.mu.Unlock()
+	b, encoding, err := wireValue(view, incomingAccept(stream.Context()))
+	if err != nil {
+		return grpcError(err)
+	}
+	if len(b) > chunkSize {
+		chunkSize = streamChunkSize
+	}
+	for off := 0; ; off += chunkSize {
+		end := off + chunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		c := &pb.Chunk{Data: b[off:end], Last: end == len(b)}
+		if off == 0 {
+			c.Size = uint64(len(b))
+			c.Encoding = encoding
+			c.Expire, c.Version = unixMilli(view.expire), view.version
+			c.NotFound = view.notFound
+			c.ContentType, c.Flags = view.contentType, view.flags
+		}
+		if c.Last {
+			c.Checksum = checksum(b)
+		}
+		if err := stream.Send(c); err != nil {
+			return err
+		}
+		if c.Last {
+			return nil
+		}
+	}
+}
+
+// errStreamUnsupported 表示远程节点不支持 GetStream
+var errStreamUnsupported = errors.New("peer does not support GetStream")
+
+// recvStream 接收 GetStream 发送的所有块并校验长度和校验和，组装为 pb.Response。
+// 声明的长度超过 limit 时直接失败，不按对方声明的长度分配内存
+func recvStream(stream pb.GroupCache_GetStreamClient, limit int64) (*pb.Response, error) {
+	var buf []byte
+	var size uint64
+	res := &pb.Response{}
+	for first := true; ; first = false {
+		c, err := stream.Recv()
+		if err == io.EOF {
+			return nil, errors.New("stream ended before the last chunk")
+		}
+		if err != nil {
+			// 旧版本的节点没有实现 GetStream，错误在第一次 Recv 时返回。
+			// 带有 pb.Error 的状态是节点处理请求时返回的错误，不是方法不存在
+			if st, _ := status.FromError(err); first && st.Code() == codes.Unimplemented && grpcErrorDetail(st) == nil {
+				return nil, errStreamUnsupported
+			}
+			return nil, err
+		}
+		if first {
+			size = c.GetSize()
+			if size > uint64(limit) {
+				return nil, fmt.Errorf("streamed value exceeds %d bytes", limit)
+			}
+			res.Encoding, res.Expire, res.Version = c.GetEncoding(), c.GetExpire(), c.GetVersion()
+			res.NotFound = c.GetNotFound()
+			res.ContentType, res.Flags = c.GetContentType(), c.GetFlags()
+			buf = make([]byte, 0, size)
+		}
+		buf = append(buf, c.GetData()...)
+		if uint64(len(buf)) > size {
+			return nil, fmt.Errorf("streamed value is longer than %d bytes", size)
+		}
+		if c.GetLast() {
+			if uint64(len(buf)) != size {
+				return nil, fmt.Errorf("streamed value has %d bytes, want %d", len(buf), size)
+			}
+			if got := checksum(buf); got != c.GetChecksum() {
+				return nil, fmt.Errorf("checksum mismatch: got %08x, want %08x", got, c.GetChecksum())
+			}
+			res.Value = buf
+			return res, nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestStreamLargeValue(t *testing.T) {
+	big := make([]byte, 6<<20) // 超过 gRPC 默认 4MB 的消息上限
+	rand.New(rand.NewSource(1)).Read(big)
+	NewGroup("stream-blobs", 64<<20, GetterFunc(func(key string) ([]byte, error) {
+		if key == "small" {
+			return []byte("v-small"), nil
+		}
+		return big, nil
+	}))
+
+	t.Run("http", func(t *testing.T) {
+		var chunked bool
+		pool := NewHTTPPool("http://remote", WithStreamThreshold(1<<20))
+		server := httptest.NewServer(pool)
+		defer server.Close()
+		p := NewHTTPPool("http://self", WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			res, err := http.DefaultTransport.RoundTrip(r)
+			if err == nil && len(res.TransferEncoding) > 0 && res.TransferEncoding[0] == "chunked" {
+				chunked = true
+			}
+			return res, err
+		})))
+		p.Set(server.URL)
+		peer, _ := p.PickPeer("big")
+
+		out := &pb.Response{}
+		if err := peer.Get(&pb.Request{Group: "stream-blobs", Key: "big"}, out); err != nil {
+			t.Fatalf("Get big failed: %v", err)
+		}
+		if !bytes.Equal(out.Value, big) || !chunked {
+			t.Fatalf("big value not streamed intact: %d bytes, chunked %v", len(out.Value), chunked)
+		}
+		if err := peer.Get(&pb.Request{Group: "stream-blobs", Key: "small"}, out); err != nil || string(out.Value) != "v-small" {
+			t.Fatalf("Get small = %q, %v", out.Value, err)
+		}
+	})
+
+	t.Run("checksum", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(streamHeader, "1")
+			w.Header().Set(sizeHeader, "5")
+			w.Header().Set(checksumHeader, strconv.FormatUint(uint64(checksum([]byte("hello"))), 10))
+			w.Write([]byte("hellO"))
+		}))
+		defer server.Close()
+		p := NewHTTPPool("http://self")
+		p.Set(server.URL)
+		peer, _ := p.PickPeer("k")
+		err := peer.Get(&pb.Request{Group: "stream-blobs", Key: "k"}, &pb.Response{})
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("corrupted stream should fail with checksum mismatch, got %v", err)
+		}
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		lis := bufconn.Listen(1 << 20)
+		var unary atomic.Int32 // 退回一元 Get 的次数
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			unary.Add(1)
+			return handler(ctx, req)
+		}))
+		NewGRPCPool("remote").Register(server)
+		go server.Serve(lis)
+		defer server.Stop()
+
+		p := NewGRPCPool("self",
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return lis.DialContext(ctx)
+			}))
+		defer p.Close()
+		if err := p.Set("remote"); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+		peer, _ := p.PickPeer("big")
+		out := &pb.Response{}
+		if err := peer.Get(&pb.Request{Group: "stream-blobs", Key: "big"}, out); err != nil {
+			t.Fatalf("Get big over gRPC failed: %v", err)
+		}
+		if !bytes.Equal(out.Value, big) {
+			t.Fatalf("big value corrupted: got %d bytes", len(out.Value))
+		}
+		err := peer.Get(&pb.Request{Group: "stream-missing", Key: "big"}, out)
+		if !errors.Is(err, ErrNoSuchGroup) {
+			t.Fatalf("Get from unknown group error = %v, want ErrNoSuchGroup", err)
+		}
+		if n := unary.Load(); n != 0 {
+			t.Errorf("unknown group fell back to unary Get %d times, want GetStream only", n)
+		}
+
+		p.SetMaxResponseSize(1 << 20)
+		err = peer.Get(&pb.Request{Group: "stream-blobs", Key: "big"}, out)
+		if err == nil || !strings.Contains(err.Error(), "exceeds") {
+			t.Fatalf("value over the limit should fail, got %v", err)
+		}
+	})
+}
+
+// roundTripFunc 把函数适配为 http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
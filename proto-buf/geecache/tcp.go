@@ -0,0 +1,633 @@
+package geecache
+
+import (
+	"Cache/proto-buf/geecache/consistenthash"
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// TCP 协议的每一帧由 4 字节的长度、4 字节的请求 ID、1 字节的类型和负载组成，整数使用大端序，
+// 长度不包括自身。请求方可以在一个连接上连续发送多个请求而不必等待响应，
+// 响应的顺序不一定与请求相同，通过请求 ID 对应。
+// 连接的第一帧必须是 hello 帧，请求 ID 为 0；认证失败时服务端以 ID 为 0 的错误帧回复并断开连接
+const (
+	frameHeaderSize = 9         // 帧头的长度
+	maxFrameSize    = 256 << 20 // 单个帧的最大长度
+	maxHelloSize    = 4 << 10   // hello 帧的最大长度，认证之前不为请求方分配更多内存
+	maxConnRequests = 128       // 一个连接上同时处理的最大请求数，达到时暂停读取后面的请求
+
+	tcpHelloPath = "/geecache.tcp/hello" // 签名 hello 帧时使用的路径
+)
+
+// 帧的类型
+const (
+	frameHello         byte = iota + 1 // 请求方建立连接后发送的第一帧，负载见 helloPayload
+	frameGet                           // 负载是 pb.Request
+	frameGetMulti                      // 负载是 pb.BatchRequest
+	frameResponse                      // 负载是 pb.Response
+	frameBatchResponse                 // 负载是 pb.BatchResponse
+	frameError                         // 负载是 pb.Error
+)
+
+// frame 是 TCP 协议中的一帧
+type frame struct {
+	id      uint32
+	typ     byte
+	payload []byte
+}
+
+// readFrame 读取一帧，帧的长度超过 limit 时返回错误
+func readFrame(r io.Reader, limit uint32) (frame, error) {
+	var h [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(h[0:4])
+	if n < frameHeaderSize-4 || n > limit {
+		return frame{}, fmt.Errorf("invalid frame length %d", n)
+	}
+	f := frame{id: binary.BigEndian.Uint32(h[4:8]), typ: h[8], payload: make([]byte, n-(frameHeaderSize-4))}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	return f, nil
+}
+
+// frameWriter 串行地写入帧，只有最后一个等待写入的帧写完后才 flush，
+// 这样流水线上同时到达的多个帧合并为一次系统调用
+type frameWriter struct {
+	mu      sync.Mutex
+	w       *bufio.Writer
+	waiting atomic.Int32 // 正在等待或者正在写入的帧数
+}
+
+func newFrameWriter(w io.Writer) *frameWriter {
+	return &frameWriter{w: bufio.NewWriter(w)}
+}
+
+// write 写入一帧
+func (fw *frameWriter) write(f frame) error {
+	if len(f.payload) > maxFrameSize-(frameHeaderSize-4) {
+		return fmt.Errorf("frame payload of %d bytes is too large", len(f.payload))
+	}
+	fw.waiting.Add(1)
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	var h [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(h[0:4], uint32(len(f.payload)+frameHeaderSize-4))
+	binary.BigEndian.PutUint32(h[4:8], f.id)
+	h[8] = f.typ
+	fw.w.Write(h[:])
+	_, err := fw.w.Write(f.payload)
+	if fw.waiting.Add(-1) == 0 && err == nil {
+		err = fw.w.Flush()
+	}
+	return err
+}
+
+// helloPayload 返回 hello 帧的负载：第一行是请求方能够解压的格式，以逗号分隔；
+// 之后每行是一个 "Name: value" 形式的凭证，例如 HMACAuth 的时间戳和签名
+func helloPayload(signer Signer) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString(acceptedEncodings())
+	if signer != nil {
+		r := rpcRequest(tcpHelloPath, nil)
+		if err := signer.Sign(r); err != nil {
+			return nil, err
+		}
+		for k := range r.Header {
+			fmt.Fprintf(&b, "\n%s: %s", k, r.Header.Get(k))
+		}
+	}
+	return []byte(b.String()), nil
+}
+
+// parseHello 解析 hello 帧的负载，返回能够解压的格式和凭证
+func parseHello(payload []byte) (accept string, header map[string][]string) {
+	lines := strings.Split(string(payload), "\n")
+	header = make(map[string][]string)
+	for _, line := range lines[1:] {
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			header[k] = append(header[k], v)
+		}
+	}
+	return lines[0], header
+}
+
+// TCPPool 实现了 PeerPicker 接口，通过自定义的二进制协议与其他节点通信，可以替代 HTTPPool 使用。
+// 每个远程节点只保持一个 TCP 连接，所有请求在这个连接上并发进行，省去了 HTTP/1.1 逐个请求的报文开销。
+// 帧的负载仍然是 geecachepb 中的消息。协议不加密，配置 SetAuth 后只在建立连接时认证一次，
+// 只应在可信的网络中使用
+type TCPPool struct {
+	self    string              // 当前节点的地址，例如 "localhost:8001"
+	timeout time.Duration       // 单次请求的超时时间
+	mu      sync.Mutex          // 用于保护以下字段的锁
+	auth    Authenticator       // 不为 nil 时要求连接在 hello 帧中通过认证
+	acl     *ACL                // 按 group 控制访问权限
+	signer  Signer              // 不为 nil 时在 hello 帧中附加凭证
+	peers   *consistenthash.Map // 哈希环，用于根据 key 选择节点
+	getters map[string]*tcpGetter
+}
+
+// NewTCPPool 初始化一个 TCP 节点池
+func NewTCPPool(self string) *TCPPool {
+	return &TCPPool{
+		self:    self,
+		timeout: defaultTimeout,
+		getters: make(map[string]*tcpGetter),
+	}
+}
+
+// Log 用于打印带有服务器名称的日志信息
+func (p *TCPPool) Log(format string, v ...interface{}) {
+	log.Printf("[TCP Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// SetTimeout 设置向其他节点请求时的超时时间
+func (p *TCPPool) SetTimeout(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.timeout = d
+}
+
+// SetAuth 要求其他节点的连接在 hello 帧中通过 auth 认证，并按 acl 检查每个请求的 group
+func (p *TCPPool) SetAuth(auth Authenticator, acl *ACL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.auth, p.acl = auth, acl
+}
+
+// SetSigner 在连接其他节点时为 hello 帧附加凭证，通常与其他节点的 SetAuth 配合使用
+func (p *TCPPool) SetSigner(s Signer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signer = s
+}
+
+// Set 更新节点池中的节点列表。仍在列表中的节点复用已有的连接，被移除的节点的连接会被关闭
+func (p *TCPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	getters := make(map[string]*tcpGetter, len(peers))
+	for _, peer := range peers {
+		if g, ok := p.getters[peer]; ok {
+			getters[peer] = g
+		} else if peer != p.self {
+			getters[peer] = &tcpGetter{peer: peer, pool: p} // 第一次请求时才建立连接
+		}
+	}
+	for peer, g := range p.getters {
+		if _, ok := getters[peer]; !ok {
+			g.close()
+		}
+	}
+
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.getters = getters
+}
+
+// PickPeer 根据 key 选择一个远程节点
+func (p *TCPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.getters[peer], true
+	}
+	return nil, false
+}
+
+// Getter 返回节点 peer 的 PeerGetter，peer 不在节点列表中或是当前节点时返回 false
+func (p *TCPPool) Getter(peer string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.getters[peer]
+	if !ok {
+		return nil, false
+	}
+	return g, true
+}
+
+// Close 关闭与所有节点的连接
+func (p *TCPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for peer, g := range p.getters {
+		g.close()
+		delete(p.getters, peer)
+	}
+	return nil
+}
+
+// ListenAndServe 监听 TCP 地址 addr 并处理其他节点的请求
+func (p *TCPPool) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve 接受 l 上其他节点的连接并处理请求，直到 l 被关闭
+func (p *TCPPool) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+// serveConn 读取连接上的请求，每个请求在单独的 goroutine 中处理，慢请求不会阻塞后面的请求
+func (p *TCPPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := newFrameWriter(conn)
+
+	// 第一帧必须是 hello 帧，在此之前只接受很短的帧
+	f, err := readFrame(r, maxHelloSize)
+	if err != nil || f.typ != frameHello {
+		if err == nil {
+			err = fmt.Errorf("first frame has type %d, want hello", f.typ)
+		}
+		if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			p.Log("handshake with %s: %v", conn.RemoteAddr(), err)
+		}
+		return
+	}
+	hello, err := p.hello(f.payload)
+	if err != nil {
+		p.Log("rejecting %s: %v", conn.RemoteAddr(), err)
+		code, _ := errorCode(err)
+		payload, _ := proto.Marshal(&pb.Error{Code: code, Message: err.Error()})
+		w.write(frame{typ: frameError, payload: payload})
+		// 读完请求方已经发出的数据再断开，避免未读的数据使连接被重置，请求方收不到错误帧
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		io.Copy(io.Discard, r)
+		return
+	}
+
+	sem := make(chan struct{}, maxConnRequests)
+	for {
+		f, err := readFrame(r, maxFrameSize)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				p.Log("reading from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		sem <- struct{}{}
+		go func(f frame) {
+			defer func() { <-sem }()
+			if err := w.write(p.handle(f, hello)); err != nil {
+				conn.Close() // 写入失败后连接上的帧已经无法对齐，由读循环退出
+			}
+		}(f)
+	}
+}
+
+// tcpHello 是请求方在 hello 帧中声明的信息
+type tcpHello struct {
+	accept        string // 请求方能够解压的格式
+	principal     string // 认证得到的身份
+	authenticated bool   // 是否通过了认证，没有配置认证时总是为 false
+}
+
+// hello 解析 hello 帧并认证请求方，认证失败时返回 ErrUnauthenticated，调用方随后断开连接
+func (p *TCPPool) hello(payload []byte) (tcpHello, error) {
+	accept, header := parseHello(payload)
+	h := tcpHello{accept: accept}
+	p.mu.Lock()
+	auth := p.auth
+	p.mu.Unlock()
+	if auth != nil {
+		principal, err := auth.Authenticate(rpcRequest(tcpHelloPath, header))
+		if err != nil {
+			return h, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		h.principal, h.authenticated = principal, true
+	}
+	return h, nil
+}
+
+// authorize 检查连接的请求方能否访问 group
+func (p *TCPPool) authorize(hello tcpHello, group string) error {
+	p.mu.Lock()
+	auth, acl := p.auth, p.acl
+	p.mu.Unlock()
+	if auth == nil {
+		return nil
+	}
+	if !hello.authenticated {
+		return ErrUnauthenticated
+	}
+	if !permitted(acl, group, hello.principal) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// handle 处理一个请求帧，返回响应帧
+func (p *TCPPool) handle(f frame, hello tcpHello) frame {
+	var res proto.Message
+	var typ byte
+	var err error
+	switch f.typ {
+	case frameGet:
+		res, err = p.serveGet(f.payload, hello)
+		typ = frameResponse
+	case frameGetMulti:
+		res, err = p.serveGetMulti(f.payload, hello)
+		typ = frameBatchResponse
+	default:
+		err = fmt.Errorf("%w: unknown frame type %d", ErrBadRequest, f.typ)
+	}
+	var payload []byte
+	if err == nil {
+		payload, err = proto.Marshal(res)
+	}
+	if err != nil {
+		code, _ := errorCode(err)
+		typ = frameError
+		payload, _ = proto.Marshal(&pb.Error{Code: code, Message: err.Error()})
+	}
+	return frame{id: f.id, typ: typ, payload: payload}
+}
+
+// serveGet 处理其他节点的 Get 请求。TCP 协议的请求方都能处理 not_found 响应
+func (p *TCPPool) serveGet(payload []byte, hello tcpHello) (*pb.Response, error) {
+	in := &pb.Request{}
+	if err := proto.Unmarshal(payload, in); err != nil {
+		return nil, fmt.Errorf("%w: decoding request: %v", ErrBadRequest, err)
+	}
+	if err := p.authorize(hello, in.GetGroup()); err != nil {
+		return nil, err
+	}
+	p.Log("Get %s/%s [%s]", in.GetGroup(), in.GetKey(), in.GetRequestId())
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchGroup, in.GetGroup())
+	}
+	view, err := peerLookup(group, in.GetKey(), false, true)
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.Response{MinuteQps: group.stats.hit(in.GetKey()), RequestId: in.GetRequestId()}
+	if err := fillResponse(res, view, hello.accept); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// serveGetMulti 处理其他节点的批量请求
+func (p *TCPPool) serveGetMulti(payload []byte, hello tcpHello) (*pb.BatchResponse, error) {
+	in := &pb.BatchRequest{}
+	if err := proto.Unmarshal(payload, in); err != nil {
+		return nil, fmt.Errorf("%w: decoding request: %v", ErrBadRequest, err)
+	}
+	if err := p.authorize(hello, in.GetGroup()); err != nil {
+		return nil, err
+	}
+	p.Log("GetMulti %s: %d keys", in.GetGroup(), len(in.GetKeys()))
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchGroup, in.GetGroup())
+	}
+	return batchResponse(group, in.GetKeys(), hello.accept), nil
+}
+
+// tcpConn 是与一个远程节点的连接，多个请求可以同时进行
+type tcpConn struct {
+	peer    string // 远程节点的地址
+	conn    net.Conn
+	w       *frameWriter
+	mu      sync.Mutex            // 保护以下字段
+	nextID  uint32                // 下一个请求的 ID
+	pending map[uint32]chan frame // 等待响应的请求，按请求 ID 索引
+	err     error                 // 连接断开的原因，不为 nil 时连接不再可用
+}
+
+// dialTCP 连接远程节点并发送 hello 帧，signer 不为 nil 时在 hello 帧中附加凭证
+func dialTCP(peer string, timeout time.Duration, signer Signer) (*tcpConn, error) {
+	hello, err := helloPayload(signer)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", peer, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &tcpConn{peer: peer, conn: conn, w: newFrameWriter(conn), pending: make(map[uint32]chan frame)}
+	if err := c.w.write(frame{typ: frameHello, payload: hello}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// readLoop 读取响应并交给等待的请求，连接出错时唤醒所有等待的请求
+func (c *tcpConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r, maxFrameSize)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		// ID 为 0 的错误帧是对 hello 帧的回复，说明连接被拒绝
+		if f.id == 0 && f.typ == frameError {
+			e := &pb.Error{}
+			if err := proto.Unmarshal(f.payload, e); err != nil {
+				c.fail(fmt.Errorf("decoding error: %v", err))
+			} else {
+				c.fail(peerResultError(c.peer, e))
+			}
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[f.id]
+		delete(c.pending, f.id)
+		c.mu.Unlock()
+		if ch != nil { // 已经超时的请求不再等待响应
+			ch <- f
+		}
+	}
+}
+
+// fail 关闭连接，所有等待中的请求返回 err
+func (c *tcpConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.conn.Close()
+}
+
+// broken 判断连接是否已经断开
+func (c *tcpConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// roundTrip 发送一个请求并等待响应
+func (c *tcpConn) roundTrip(typ byte, payload []byte, timeout time.Duration) (frame, error) {
+	ch := make(chan frame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return frame{}, err
+	}
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID++ // ID 0 留给 hello 帧
+	}
+	id := c.nextID
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.w.write(frame{id: id, typ: typ, payload: payload}); err != nil {
+		c.fail(err)
+		return frame{}, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case f, ok := <-ch:
+		if !ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			return frame{}, c.err
+		}
+		return f, nil
+	case <-timer.C:
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return frame{}, fmt.Errorf("%w: no response in %v", ErrTimeout, timeout)
+	}
+}
+
+// tcpGetter 实现了 PeerGetter 接口，通过 TCP 协议从远程节点获取数据
+type tcpGetter struct {
+	peer string   // 远程节点的地址
+	pool *TCPPool // 所属的节点池，提供请求的超时时间
+	mu   sync.Mutex
+	conn *tcpConn // 与远程节点的连接，断开后在下一次请求时重新建立
+}
+
+// getConn 返回可用的连接，必要时重新建立
+func (g *tcpGetter) getConn(timeout time.Duration, signer Signer) (*tcpConn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn != nil && !g.conn.broken() {
+		return g.conn, nil
+	}
+	conn, err := dialTCP(g.peer, timeout, signer)
+	if err != nil {
+		return nil, err
+	}
+	g.conn = conn
+	return conn, nil
+}
+
+// close 关闭与远程节点的连接
+func (g *tcpGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn != nil {
+		g.conn.fail(net.ErrClosed)
+		g.conn = nil
+	}
+}
+
+// call 发送类型为 typ 的请求，把类型为 want 的响应解码到 out。
+// 远程节点返回的错误转换为 PeerError，连接层面的错误原样返回
+func (g *tcpGetter) call(typ byte, in proto.Message, want byte, out proto.Message) error {
+	g.pool.mu.Lock()
+	timeout, signer := g.pool.timeout, g.pool.signer
+	g.pool.mu.Unlock()
+
+	payload, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	conn, err := g.getConn(timeout, signer)
+	if err != nil {
+		return err
+	}
+	f, err := conn.roundTrip(typ, payload, timeout)
+	if err != nil {
+		return err
+	}
+	switch f.typ {
+	case want:
+		if err := proto.Unmarshal(f.payload, out); err != nil {
+			return fmt.Errorf("decoding response body: %v", err)
+		}
+		return nil
+	case frameError:
+		e := &pb.Error{}
+		if err := proto.Unmarshal(f.payload, e); err != nil {
+			return fmt.Errorf("decoding error: %v", err)
+		}
+		return peerResultError(g.peer, e)
+	}
+	return fmt.Errorf("unexpected frame type %d from %s", f.typ, g.peer)
+}
+
+// Get 从远程节点获取数据
+func (g *tcpGetter) Get(in *pb.Request, out *pb.Response) error {
+	return g.call(frameGet, in, frameResponse, out)
+}
+
+// GetMulti 通过一次请求从远程节点获取多个 key
+func (g *tcpGetter) GetMulti(in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return g.call(frameGetMulti, in, frameBatchResponse, out)
+}
+
+// String 返回节点的地址
+func (g *tcpGetter) String() string {
+	return g.peer
+}
+
+// Addr 实现了 PeerAddresser 接口
+func (g *tcpGetter) Addr() string {
+	return g.peer
+}
+
+// 确保 TCPPool 实现了 PeerPicker 接口，tcpGetter 实现了 PeerGetter、BatchPeerGetter 和 PeerAddresser 接口
+var (
+	_ PeerPicker      = (*TCPPool)(nil)
+	_ PeerGetter      = (*tcpGetter)(nil)
+	_ BatchPeerGetter = (*tcpGetter)(nil)
+	_ PeerAddresser   = (*tcpGetter)(nil)
+)
@@ -0,0 +1,204 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// listenTCP 在回环地址上启动一个 TCPPool 服务端，返回它的地址
+func listenTCP(t testing.TB) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go NewTCPPool(l.Addr().String()).Serve(l)
+	return l.Addr().String()
+}
+
+func TestTCPPool(t *testing.T) {
+	g := NewGroup("tcp-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		switch key {
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "missing":
+			return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+		return []byte("v-" + key), nil
+	}))
+
+	addr := listenTCP(t)
+	p := NewTCPPool("self")
+	defer p.Close()
+	p.SetTimeout(100 * time.Millisecond)
+	p.Set(addr)
+	peer, ok := p.PickPeer("Tom")
+	if !ok {
+		t.Fatalf("PickPeer should pick the remote node")
+	}
+
+	// 同一个连接上并发的请求各自拿到自己的响应
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if v, err := g.getFromPeer(peer, key); err != nil || v.String() != "v-"+key {
+				t.Errorf("getFromPeer(%s) = %q, %v", key, v, err)
+			}
+		}(fmt.Sprint("k", i))
+	}
+	wg.Wait()
+	conn := peer.(*tcpGetter).conn
+	if conn == nil || conn.broken() {
+		t.Fatalf("expect a single persistent connection")
+	}
+
+	// 慢请求超时，不影响同一连接上之后的请求
+	if _, err := g.getFromPeer(peer, "slow"); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expect timeout for slow key, got %v", err)
+	}
+	if v, err := g.getFromPeer(peer, "Tom"); err != nil || v.String() != "v-Tom" {
+		t.Errorf("getFromPeer after timeout = %q, %v", v, err)
+	}
+
+	// 不存在的 key 以 not_found 返回，不存在的 group 转换为 PeerError
+	res := &pb.Response{}
+	if err := peer.Get(&pb.Request{Group: "tcp-scores", Key: "missing"}, res); err != nil || !res.GetNotFound() {
+		t.Errorf("expect a not_found response, got %v, %v", res, err)
+	}
+	err := peer.Get(&pb.Request{Group: "tcp-unknown", Key: "Tom"}, res)
+	var pe *PeerError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrNoSuchGroup) {
+		t.Errorf("expect a no_such_group PeerError, got %v", err)
+	}
+
+	batch := &pb.BatchResponse{}
+	err = peer.(BatchPeerGetter).GetMulti(&pb.BatchRequest{Group: "tcp-scores", Keys: []string{"a", "missing"}}, batch)
+	if err != nil || len(batch.GetResults()) != 2 || string(batch.Results[0].GetValue()) != "v-a" || batch.Results[1].GetError().GetCode() != "not_found" {
+		t.Errorf("GetMulti = %v, %v", batch, err)
+	}
+
+	// 连接断开后下一次请求重新建立连接
+	conn.fail(io.ErrUnexpectedEOF)
+	if v, err := g.getFromPeer(peer, "Jack"); err != nil || v.String() != "v-Jack" {
+		t.Errorf("getFromPeer after reconnect = %q, %v", v, err)
+	}
+	if peer.(*tcpGetter).conn == conn {
+		t.Errorf("expect a new connection after the old one broke")
+	}
+}
+
+func TestTCPPoolAuth(t *testing.T) {
+	g := NewGroup("tcp-auth", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+	peerAuth := NewHMACAuth([]byte("cluster-key"))
+	acl := NewACL()
+	acl.Allow("tcp-auth", "alice")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	remote := NewTCPPool(l.Addr().String())
+	remote.SetAuth(MultiAuth{peerAuth, TokenAuth{"alice-token": "alice", "bob-token": "bob"}}, acl)
+	go remote.Serve(l)
+
+	get := func(signer Signer) error {
+		p := NewTCPPool("self")
+		defer p.Close()
+		if signer != nil {
+			p.SetSigner(signer)
+		}
+		p.Set(l.Addr().String())
+		peer, _ := p.PickPeer("Tom")
+		_, err := g.getFromPeer(peer, "Tom")
+		return err
+	}
+	tests := []struct {
+		name   string
+		signer Signer
+		want   error
+	}{
+		{"peer", peerAuth, nil},
+		{"alice", bearerSigner("alice-token"), nil},
+		{"bob", bearerSigner("bob-token"), ErrForbidden},
+		{"wrong key", NewHMACAuth([]byte("other")), ErrUnauthenticated},
+		{"anonymous", nil, ErrUnauthenticated},
+	}
+	for _, tt := range tests {
+		if err := get(tt.signer); (tt.want == nil && err != nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: getFromPeer error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestTCPHandshakeLimits(t *testing.T) {
+	addr := listenTCP(t)
+	// 在 hello 帧之前声明一个很大的帧，服务端不分配内存而是直接断开连接
+	tests := map[string][]byte{
+		"large hello":   {0x10, 0, 0, 0, 0, 0, 0, 0, frameHello},
+		"request first": {0, 0, 0, 5, 0, 0, 0, 1, frameGet},
+	}
+	for name, header := range tests {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(header)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("%s: read error = %v, want EOF", name, err)
+		}
+		conn.Close()
+	}
+}
+
+// BenchmarkPeerTransport 比较小 value 在 HTTP 和 TCP 协议下从远程节点读取的开销
+func BenchmarkPeerTransport(b *testing.B) {
+	NewGroup("bench-transport", 2<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("630"), nil
+	}))
+	log.SetOutput(io.Discard) // 每个请求都会打印日志，避免干扰结果
+	defer log.SetOutput(os.Stderr)
+
+	server := httptest.NewServer(NewHTTPPool("http://remote"))
+	defer server.Close()
+	hp := NewHTTPPool("http://self")
+	hp.Set(server.URL)
+	httpPeer, _ := hp.PickPeer("Tom")
+
+	tp := NewTCPPool("self")
+	defer tp.Close()
+	tp.Set(listenTCP(b))
+	tcpPeer, _ := tp.PickPeer("Tom")
+
+	for _, bm := range []struct {
+		name string
+		peer PeerGetter
+	}{{"http", httpPeer}, {"tcp", tcpPeer}} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.RunParallel(func(it *testing.PB) {
+				req := &pb.Request{Group: "bench-transport", Key: "Tom"}
+				for it.Next() {
+					if err := bm.peer.Get(req, &pb.Response{}); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
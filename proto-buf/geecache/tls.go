@@ -0,0 +1,157 @@
+package geecache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSFiles 是节点间双向 TLS 使用的证书文件
+type TLSFiles struct {
+	CertFile string // 当前节点的证书，同时用作服务端证书和客户端证书
+	KeyFile  string // 证书对应的私钥
+	CAFile   string // 用于校验其他节点证书的 CA 证书
+}
+
+// CertReloader 从文件加载证书和 CA，并支持在不重启的情况下重新加载。
+// 每次 TLS 握手都会使用最近一次加载成功的证书和 CA
+type CertReloader struct {
+	files TLSFiles
+	mu    sync.RWMutex     // 保护 cert 和 roots
+	cert  *tls.Certificate // 当前节点的证书
+	roots *x509.CertPool   // 受信任的 CA
+}
+
+// NewCertReloader 加载证书文件，文件无效时返回错误
+func NewCertReloader(files TLSFiles) (*CertReloader, error) {
+	r := &CertReloader{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载证书文件。加载失败时保留原来的证书
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading key pair: %v", err)
+	}
+	pem, err := os.ReadFile(r.files.CAFile)
+	if err != nil {
+		return fmt.Errorf("reading CA file: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return errors.New("no CA certificates found in " + r.files.CAFile)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.roots = roots
+	r.mu.Unlock()
+	return nil
+}
+
+// Watch 周期性地检查证书文件的修改时间，发生变化时重新加载，返回的 stop 函数用于停止检查
+func (r *CertReloader) Watch(interval time.Duration) (stop func()) {
+	last := r.modTime()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			if t := r.modTime(); !t.Equal(last) {
+				if err := r.Reload(); err != nil {
+					log.Printf("[TLS] reloading certificates: %v", err)
+					continue // 证书可能还没写完，下次再试
+				}
+				last = t
+				log.Println("[TLS] certificates reloaded")
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// modTime 返回三个证书文件中最新的修改时间
+func (r *CertReloader) modTime() time.Time {
+	var latest time.Time
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if fi, err := os.Stat(name); err == nil && fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
+
+// current 返回当前的证书和 CA
+func (r *CertReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.roots
+}
+
+// ServerConfig 返回服务端的 TLS 配置，要求客户端提供由 CA 签发的证书
+func (r *CertReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// 每次握手时取最新的证书和 CA，重新加载后无需重启服务
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, roots := r.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    roots,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}, nil
+		},
+	}
+}
+
+// ClientConfig 返回客户端的 TLS 配置，出示当前节点的证书并用 CA 校验服务端
+func (r *CertReloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		},
+		// RootCAs 在握手前就固定了，为了支持重新加载 CA，
+		// 关闭默认校验，改为在 VerifyConnection 中用最新的 CA 校验
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tls: peer presented no certificate")
+			}
+			_, roots := r.current()
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}
+}
+
+// WithTLS 让 HTTPPool 通过双向 TLS 访问其他节点，节点地址需要使用 https
+func WithTLS(r *CertReloader) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.tlsConfig = r.ClientConfig()
+	}
+}
@@ -0,0 +1,134 @@
+package geecache
+
+import (
+	pb "Cache/proto-buf/geecache/geecachepb"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 是测试用的自签名 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发一张同时用于服务端和客户端的证书，并把证书、私钥和 CA 写入 dir
+func (ca *testCA) issue(t *testing.T, dir string) TLSFiles {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "geecache-peer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	files := TLSFiles{
+		CertFile: filepath.Join(dir, "peer.crt"),
+		KeyFile:  filepath.Join(dir, "peer.key"),
+		CAFile:   filepath.Join(dir, "ca.crt"),
+	}
+	os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	os.WriteFile(files.CAFile, ca.pem, 0600)
+	return files
+}
+
+func TestMutualTLS(t *testing.T) {
+	NewGroup("tls-scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v-" + key), nil
+	}))
+
+	ca := newTestCA(t, "geecache-ca")
+	serverFiles := ca.issue(t, t.TempDir())
+	clientFiles := ca.issue(t, t.TempDir())
+
+	serverCerts, err := NewCertReloader(serverFiles)
+	if err != nil {
+		t.Fatalf("NewCertReloader failed: %v", err)
+	}
+	server := httptest.NewUnstartedServer(NewHTTPPool("https://remote"))
+	server.TLS = serverCerts.ServerConfig()
+	server.Config.SetKeepAlivesEnabled(false) // 每个请求都重新握手，以便观察证书的重新加载
+	server.StartTLS()
+	defer server.Close()
+
+	clientCerts, err := NewCertReloader(clientFiles)
+	if err != nil {
+		t.Fatalf("NewCertReloader failed: %v", err)
+	}
+	p := NewHTTPPool("https://self", WithTLS(clientCerts))
+	p.Set(server.URL)
+
+	get := func() error {
+		peer, _ := p.PickPeer("Tom")
+		return peer.Get(&pb.Request{Group: "tls-scores", Key: "Tom"}, &pb.Response{})
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Get over mTLS failed: %v", err)
+	}
+
+	// 没有客户端证书的请求被拒绝
+	plain := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if res, err := plain.Get(server.URL + defaultBasePath + "tls-scores/Tom"); err == nil {
+		res.Body.Close()
+		t.Fatalf("request without client certificate should fail")
+	}
+
+	// 服务端换成新 CA 签发的证书后，客户端在重新加载 CA 之前拒绝连接
+	rotated := newTestCA(t, "geecache-ca-2")
+	rotated.issue(t, filepath.Dir(serverFiles.CertFile))
+	if err := serverCerts.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := get(); err == nil {
+		t.Fatalf("client should reject a server certificate from an unknown CA")
+	}
+	rotated.issue(t, filepath.Dir(clientFiles.CertFile))
+	if err := clientCerts.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if err := get(); err != nil {
+		t.Fatalf("Get after reloading certificates failed: %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package geecache
+
+// Topology 描述节点所在的故障域
+type Topology struct {
+	Zone string `json:"zone,omitempty"` // 可用区，例如 "us-east-1a"
+	Rack string `json:"rack,omitempty"` // 机架，例如 "rack-3"
+}
+
+// Peer 是带有拓扑标签和权重的节点
+type Peer struct {
+	Addr     string `json:"addr"`             // 节点的 URL，例如 "http://10.0.0.2:8001"
+	Weight   int    `json:"weight,omitempty"` // 哈希环上的权重，0 表示默认权重 1
+	Topology        // 节点所在的故障域
+}
+
+// spreadReplicas 从按哈希环顺序排列的候选节点中选出 n 个副本，
+// 优先覆盖不同的可用区，其次覆盖不同的机架，最后再按环上顺序补齐。
+// 候选列表的第一个节点（主节点）总是排在结果首位。
+func spreadReplicas(candidates []string, topology map[string]Topology, n int) []string {
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	replicas := make([]string, 0, n)
+	picked := make(map[string]bool, n)
+	zones := make(map[string]bool)
+	racks := make(map[Topology]bool)
+
+	pick := func(node string) {
+		t := topology[node]
+		replicas = append(replicas, node)
+		picked[node] = true
+		zones[t.Zone] = true
+		racks[t] = true
+	}
+
+	// 依次放宽条件：新的可用区 -> 新的机架 -> 任意节点
+	passes := []func(t Topology) bool{
+		func(t Topology) bool { return !zones[t.Zone] },
+		func(t Topology) bool { return !racks[t] },
+		func(t Topology) bool { return true },
+	}
+	for _, accept := range passes {
+		for _, node := range candidates {
+			if len(replicas) == n {
+				return replicas
+			}
+			if !picked[node] && accept(topology[node]) {
+				pick(node)
+			}
+		}
+	}
+	return replicas
+}
@@ -0,0 +1,55 @@
+package geecache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpreadReplicas(t *testing.T) {
+	topology := map[string]Topology{
+		"a1": {Zone: "a", Rack: "r1"},
+		"a2": {Zone: "a", Rack: "r2"},
+		"a3": {Zone: "a", Rack: "r1"},
+		"b1": {Zone: "b", Rack: "r1"},
+		"c1": {Zone: "c", Rack: "r1"},
+	}
+	candidates := []string{"a1", "a3", "a2", "b1", "c1"}
+
+	cases := map[int][]string{
+		1: {"a1"},
+		3: {"a1", "b1", "c1"},
+		4: {"a1", "b1", "c1", "a2"},
+		5: {"a1", "b1", "c1", "a2", "a3"},
+	}
+	for n, expect := range cases {
+		if got := spreadReplicas(candidates, topology, n); !reflect.DeepEqual(got, expect) {
+			t.Errorf("spreadReplicas(%d) = %v, expect %v", n, got, expect)
+		}
+	}
+}
+
+func TestPickPeerPrefersSameZone(t *testing.T) {
+	peers := []Peer{
+		{Addr: "http://a", Topology: Topology{Zone: "z1"}},
+		{Addr: "http://b", Topology: Topology{Zone: "z2"}},
+		{Addr: "http://c", Topology: Topology{Zone: "z3"}},
+		{Addr: "http://d", Topology: Topology{Zone: "z1"}},
+	}
+	p := NewHTTPPool("http://a")
+	p.SetPeers(peers...)
+	p.SetReplicaSetSize(3)
+
+	for _, key := range []string{"Tom", "Jack", "Sam", "kkk"} {
+		replicas := p.ReplicaSet(key)
+		if len(replicas) != 3 {
+			t.Fatalf("ReplicaSet(%s) = %v, expect 3 replicas", key, replicas)
+		}
+		peer, ok := p.PickPeer(key)
+		if !ok {
+			continue // 当前节点就在副本集合中，从本地读取
+		}
+		if got := peer.(*httpGetter).baseURL; got != "http://d"+defaultBasePath {
+			t.Errorf("PickPeer(%s) = %s, expect same-zone peer http://d", key, got)
+		}
+	}
+}
@@ -5,15 +5,80 @@ $ curl "http://localhost:9999/api?key=Tom"
 630
 
 $ curl "http://localhost:9999/api?key=kkk"
-kkk not exist
+kkk not exist: geecache: not found
+
+REST API 可以访问任意 group，并且支持写入、删除、批量读取和创建 group：
+$ curl -i "http://localhost:9999/v1/groups/scores/keys/Tom"
+HTTP/1.1 200 OK
+Content-Type: application/octet-stream
+Etag: "17c3f2e1a9b0c4d8"
+
+630
+$ curl -X PUT -H "Content-Type: application/json" -d '{"score":630}' "http://localhost:9999/v1/groups/scores/keys/Tom?ttl=10m"
+$ curl -d '{"keys":["Tom","Jack"]}' "http://localhost:9999/v1/groups/scores/mget"
+$ curl -d '{"name":"sessions","cacheBytes":1048576,"ttl":"30m"}' "http://localhost:9999/v1/groups"
+$ curl "http://localhost:9999/v1/groups"
+
+使用 gossip 动态维护节点列表：
+$ ./server -port=8001 -gossip=127.0.0.1:7001
+$ ./server -port=8002 -gossip=127.0.0.1:7002 -seeds=127.0.0.1:7001
+$ ./server -port=8003 -gossip=127.0.0.1:7003 -seeds=127.0.0.1:7001
+
+节点之间使用双向 TLS：
+$ ./server -port=8001 -tls-cert=peer.crt -tls-key=peer.key -tls-ca=ca.crt
+
+节点之间使用共享密钥签名，API 使用 token 认证并按 group 授权：
+$ ./server -port=8001 -api -peer-key=secret -api-tokens=t1=alice,t2=bob -acl=scores=alice
+$ curl -H "Authorization: Bearer t1" "http://localhost:9999/api?key=Tom"
+630
+
+使用 gRPC 代替 HTTP 在节点之间通信：
+$ ./server -port=8001 -grpc
+
+使用二进制 TCP 协议在节点之间通信，每个节点只保持一个连接：
+$ ./server -port=8001 -tcp
+
+从配置文件读取节点列表，修改文件后自动生效：
+$ ./server -peers-file=peers.example.json
+
+通过 Redis 协议访问，key 的格式为 group:key，不带前缀时属于 scores：
+$ ./server -port=8001 -resp=localhost:6379
+$ redis-cli -p 6379 GET scores:Tom
+"630"
+
+通过 memcached 协议访问：
+$ ./server -port=8001 -memcache=localhost:11211
+$ printf "get scores:Tom\r\n" | nc localhost 11211
+VALUE scores:Tom 0 3
+630
+END
+
+通过 DNS 发现节点，-self 需要与 DNS 解析出的地址一致：
+$ ./server -self=http://10.0.0.1:8001 -dns=geecache.cache.svc.cluster.local
+$ ./server -self=http://10.0.0.1:8001 -dns=_geecache._tcp.geecache.cache.svc.cluster.local -dns-srv
 */
 
 import (
 	"Cache/proto-buf/geecache"
+	"Cache/proto-buf/geecache/discovery"
+	"Cache/proto-buf/geecache/membership"
+	"Cache/proto-buf/geecache/memcache"
+	"Cache/proto-buf/geecache/resp"
+	"Cache/proto-buf/geecache/rest"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
 )
 
 var db = map[string]string{
@@ -31,36 +96,183 @@ func createGroup() *geecache.Group {
 			if v, ok := db[key]; ok {               // 如果数据库中有该键
 				return []byte(v), nil // 返回值
 			}
-			return nil, fmt.Errorf("%s not exist", key) // 键不存在时返回错误
+			return nil, fmt.Errorf("%s not exist: %w", key, geecache.ErrNotFound) // 键不存在时返回错误
 		}))
 }
 
-// startCacheServer 启动缓存服务器
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	// 创建一个 HTTP 池，用于缓存的分布式访问
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)      // 设置其他节点的地址
-	gee.RegisterPeers(peers) // 注册缓存节点
+// startMembership 通过 gossip 维护节点列表，成员变化时更新哈希环
+func startMembership(addr, bind string, seeds []string, peers *geecache.HTTPPool) *membership.Memberlist {
+	m, err := membership.New(membership.Config{
+		Name:     addr,
+		BindAddr: bind,
+		OnChange: func(live []membership.Member) {
+			addrs := make([]string, len(live))
+			for i, member := range live {
+				addrs[i] = member.Name
+			}
+			log.Println("members changed:", addrs)
+			peers.Set(addrs...) // 用存活成员重建哈希环
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(seeds) > 0 {
+		if _, err := m.Join(seeds...); err != nil {
+			log.Println("join cluster failed:", err) // 种子节点可能尚未启动，等待它们加入即可
+		}
+	}
+	return m
+}
+
+// startDNSDiscovery 周期性地解析 DNS 名称，解析结果变化时更新哈希环
+func startDNSDiscovery(name string, srv bool, port int, scheme string, peers *geecache.HTTPPool) *discovery.DNS {
+	d, err := discovery.NewDNS(discovery.DNSConfig{
+		Name:     name,
+		SRV:      srv,
+		Port:     port,
+		Scheme:   scheme,
+		Interval: 10 * time.Second,
+		OnChange: func(addrs []string) {
+			log.Println("peers resolved:", addrs)
+			peers.Set(addrs...)
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return d
+}
+
+// startCacheServer 启动缓存服务器，收到 SIGTERM 或 SIGINT 后先把热点数据移交给其他节点再退出
+func startCacheServer(addr string, peers *geecache.HTTPPool, gee *geecache.Group, handoff int, leave func(), certs *geecache.CertReloader) {
+	gee.RegisterPeers(peers)                // 注册缓存节点
+	peers.StartHealthCheck(5 * time.Second) // 定期检查其他节点，弹出故障节点
+	u, err := url.Parse(addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{Addr: u.Host, Handler: peers}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+		log.Println("received", <-sig, "draining")
+		// 先推送热点数据，再通知其他节点自己已经离开，这样流量切换过去时新节点已经预热。
+		// 推送和关闭服务器共用同一个期限
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		peers.Drain(ctx, handoff)
+		if leave != nil {
+			leave()
+		}
+		server.Shutdown(ctx) // 等待正在处理的请求完成
+	}()
+
 	log.Println("geecache is running at", addr)
 	// 启动 HTTP 服务，监听缓存请求
-	log.Fatal(http.ListenAndServe(addr[7:], peers)) // 忽略前缀 "http://"
+	if certs != nil {
+		// 证书由 certs 在握手时提供，这里不需要再指定证书文件
+		server.TLSConfig = certs.ServerConfig()
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
 }
 
-// startAPIServer 启动 API 服务器
-func startAPIServer(apiAddr string, gee *geecache.Group) {
+// startGRPCCacheServer 启动基于 gRPC 的缓存服务器，peerAuth 不为 nil 时节点之间互相签名
+func startGRPCCacheServer(addr string, addrs []string, gee *geecache.Group, peerAuth *geecache.HMACAuth) {
+	peers := geecache.NewGRPCPool(addr)
+	if peerAuth != nil {
+		peers.SetAuth(peerAuth, nil)
+		peers.SetSigner(peerAuth)
+	}
+	if err := peers.Set(addrs...); err != nil { // 设置其他节点的地址
+		log.Fatal(err)
+	}
+	gee.RegisterPeers(peers) // 注册缓存节点
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := grpc.NewServer(peers.ServerOptions()...)
+	peers.Register(server)
+	log.Println("geecache is running at", addr, "over gRPC")
+	log.Fatal(server.Serve(lis))
+}
+
+// startTCPCacheServer 启动基于二进制 TCP 协议的缓存服务器，peerAuth 不为 nil 时节点之间互相签名
+func startTCPCacheServer(addr string, addrs []string, gee *geecache.Group, peerAuth *geecache.HMACAuth) {
+	peers := geecache.NewTCPPool(addr)
+	if peerAuth != nil {
+		peers.SetAuth(peerAuth, nil)
+		peers.SetSigner(peerAuth)
+	}
+	peers.Set(addrs...) // 设置其他节点的地址
+	gee.RegisterPeers(peers)
+	log.Println("geecache is running at", addr, "over TCP")
+	log.Fatal(peers.ListenAndServe(addr))
+}
+
+// parseTokens 解析 "token=principal,token=principal" 形式的 token 列表，
+// 节点身份只能通过 -peer-key 获得，不能分配给 token
+func parseTokens(s string) geecache.TokenAuth {
+	tokens := geecache.TokenAuth{}
+	for _, kv := range strings.Split(s, ",") {
+		if token, principal, ok := strings.Cut(kv, "="); ok {
+			if principal == geecache.PeerPrincipal {
+				log.Fatalf("-api-tokens: principal %s is reserved for peers", principal)
+			}
+			tokens[token] = principal
+		}
+	}
+	return tokens
+}
+
+// parseACL 解析 "group=principal|principal,group=principal" 形式的访问控制列表
+func parseACL(s string) *geecache.ACL {
+	acl := geecache.NewACL()
+	for _, rule := range strings.Split(s, ",") {
+		if group, principals, ok := strings.Cut(rule, "="); ok {
+			acl.Allow(group, strings.Split(principals, "|")...)
+		}
+	}
+	return acl
+}
+
+// startAPIServer 启动 API 服务器，auth 不为 nil 时要求请求携带 token 并按 acl 授权。
+// /api 只读取 gee，/v1/ 下是可以访问所有 group 的 REST API
+func startAPIServer(apiAddr string, gee *geecache.Group, auth geecache.Authenticator, acl *geecache.ACL) {
+	http.Handle("/v1/", rest.NewHandler(rest.Config{Auth: auth, ACL: acl}))
 	// 处理 /api 路径的请求
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			if _, err := geecache.Authorize(auth, acl, r, gee.Name()); err != nil {
+				http.Error(w, err.Error(), geecache.HTTPStatus(err))
+				return
+			}
 			key := r.URL.Query().Get("key") // 从 URL 查询参数中获取 key
 			view, err := gee.Get(key)       // 从缓存中获取值
 			if err != nil {                 // 如果出现错误
-				http.Error(w, err.Error(), http.StatusInternalServerError) // 返回错误
+				http.Error(w, err.Error(), geecache.HTTPStatus(err)) // 按错误类型返回状态码
+				return
+			}
+			b, err := view.Bytes()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 			// 设置响应头为二进制流类型
 			w.Header().Set("Content-Type", "application/octet-stream")
 			// 写入缓存的值
-			w.Write(view.ByteSlice())
+			w.Write(b)
 		}))
 	log.Println("fontend server is running at", apiAddr)
 	// 启动 API 服务
@@ -69,12 +281,40 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 
 func main() {
 	// 定义命令行参数
-	var port int
+	var port, handoff int
 	var api bool
+	var self, gossip, seeds, peersFile, dnsName string
+	var peerKey, apiTokens, aclRules, respAddr, memcacheAddr string
+	var tlsFiles geecache.TLSFiles
+	var dnsSRV, useGRPC, useTCP bool
+	var grace, peerTimeout time.Duration
 	// 设置端口和是否启动 API 服务器的标志
 	flag.IntVar(&port, "port", 8001, "Geecache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server?")
+	flag.BoolVar(&useGRPC, "grpc", false, "Talk to peers over gRPC instead of HTTP")
+	flag.BoolVar(&useTCP, "tcp", false, "Talk to peers over the binary TCP protocol instead of HTTP")
+	flag.IntVar(&handoff, "handoff", 1000, "Hot entries per group pushed to new owners on shutdown, requires -peer-key")
+	flag.StringVar(&gossip, "gossip", "", "Gossip listen address, enables dynamic membership")
+	flag.StringVar(&seeds, "seeds", "", "Comma separated gossip addresses of seed nodes")
+	flag.StringVar(&peersFile, "peers-file", "", "JSON file with self address and peer list, reloaded on change")
+	flag.StringVar(&self, "self", "", "URL of this node as seen by peers, defaults to http://localhost:<port>")
+	flag.StringVar(&dnsName, "dns", "", "DNS name resolved into the peer list")
+	flag.BoolVar(&dnsSRV, "dns-srv", false, "Resolve -dns as SRV records instead of A records")
+	flag.StringVar(&tlsFiles.CertFile, "tls-cert", "", "Certificate of this node, enables mutual TLS between peers")
+	flag.StringVar(&tlsFiles.KeyFile, "tls-key", "", "Private key of -tls-cert")
+	flag.StringVar(&tlsFiles.CAFile, "tls-ca", "", "CA bundle used to verify other peers")
+	flag.StringVar(&peerKey, "peer-key", "", "Shared secret used to sign requests between peers")
+	flag.StringVar(&apiTokens, "api-tokens", "", "Comma separated token=principal pairs accepted by the API server, the Redis and the memcached protocols")
+	flag.StringVar(&aclRules, "acl", "", "Comma separated group=principal|principal rules, groups without a rule are denied")
+	flag.StringVar(&respAddr, "resp", "", "Address of the Redis protocol listener, disabled when empty")
+	flag.StringVar(&memcacheAddr, "memcache", "", "Address of the memcached protocol listener, disabled when empty")
+	flag.DurationVar(&peerTimeout, "peer-timeout", 5*time.Second, "Timeout of a single request to another peer")
+	flag.DurationVar(&grace, "rebalance-grace", 0, "After the peer list changes, ask previous owners before loading locally for this long")
 	flag.Parse()
+	// mTLS 只用于 HTTP 节点之间的通信，gRPC 和 TCP 节点不会加密
+	if tlsFiles.CertFile != "" && (useGRPC || useTCP) {
+		log.Fatal("-tls-cert only applies to the HTTP transport, it cannot be used with -grpc or -tcp")
+	}
 
 	apiAddr := "http://localhost:9999" // API 服务器地址
 	// 定义可用的缓存节点地址
@@ -84,20 +324,127 @@ func main() {
 		8003: "http://localhost:8003",
 	}
 
+	// 启用 mTLS 时节点之间使用 https 通信
+	scheme := "http"
+	var certs *geecache.CertReloader
+	if tlsFiles.CertFile != "" {
+		var err error
+		if certs, err = geecache.NewCertReloader(tlsFiles); err != nil {
+			log.Fatal(err)
+		}
+		certs.Watch(10 * time.Second) // 证书文件更新后自动重新加载
+		scheme = "https"
+	}
+
 	// 收集所有节点地址
 	var addrs []string
 	for _, v := range addrMap {
-		addrs = append(addrs, v)
+		addrs = append(addrs, strings.Replace(v, "http", scheme, 1))
 	}
 
 	// 创建一个缓存组
 	gee := createGroup()
 
+	// API 服务、Redis 和 memcached 协议使用同样的 token 和访问控制
+	var auth geecache.Authenticator
+	var acl *geecache.ACL
+	if apiTokens != "" {
+		auth = parseTokens(apiTokens)
+		if aclRules != "" {
+			acl = parseACL(aclRules)
+		}
+	}
+
 	// 如果设置了启动 API 服务器，则启动
 	if api {
-		go startAPIServer(apiAddr, gee)
+		go startAPIServer(apiAddr, gee, auth, acl)
+	}
+
+	// Redis 客户端可以直接访问缓存，配置了 -api-tokens 时需要先 AUTH <token>
+	if respAddr != "" {
+		go func() {
+			log.Println("redis protocol server is running at", respAddr)
+			rs := resp.NewServer(resp.Config{DefaultGroup: gee.Name(), Auth: auth, ACL: acl})
+			log.Fatal(rs.ListenAndServe(respAddr))
+		}()
+	}
+
+	// memcached 客户端可以直接访问缓存，配置了 -api-tokens 时需要先用 set 发送 "<username> <token>" 认证
+	if memcacheAddr != "" {
+		go func() {
+			log.Println("memcached protocol server is running at", memcacheAddr)
+			ms := memcache.NewServer(memcache.Config{DefaultGroup: gee.Name(), Auth: auth, ACL: acl})
+			log.Fatal(ms.ListenAndServe(memcacheAddr))
+		}()
+	}
+
+	// 节点之间互相签名，只有持有密钥的节点才能读取和写入缓存
+	var peerAuth *geecache.HMACAuth
+	if peerKey != "" {
+		peerAuth = geecache.NewHMACAuth([]byte(peerKey))
+	} else if handoff > 0 {
+		// 其他节点只接受签名的推送，没有密钥时推送一定会被拒绝
+		log.Println("-handoff requires -peer-key, hot entries will not be handed off on shutdown")
+		handoff = 0
+	}
+
+	if useGRPC || useTCP {
+		// gRPC 和 TCP 节点使用 host:port 形式的地址
+		hostAddrs := make([]string, len(addrs))
+		for i, a := range addrs {
+			u, err := url.Parse(a)
+			if err != nil || u.Host == "" {
+				log.Fatalf("invalid peer address %q", a)
+			}
+			hostAddrs[i] = u.Host
+		}
+		if useTCP {
+			startTCPCacheServer(fmt.Sprintf("localhost:%d", port), hostAddrs, gee, peerAuth)
+		} else {
+			startGRPCCacheServer(fmt.Sprintf("localhost:%d", port), hostAddrs, gee, peerAuth)
+		}
+		return
+	}
+
+	// 创建一个 HTTP 池，用于缓存的分布式访问
+	addr := fmt.Sprintf("%s://localhost:%d", scheme, port)
+	if self != "" {
+		addr = self
+	}
+	opts := []geecache.HTTPPoolOption{geecache.WithTimeout(peerTimeout)}
+	if certs != nil {
+		opts = append(opts, geecache.WithTLS(certs))
+	}
+	if peerAuth != nil {
+		opts = append(opts, geecache.WithAuth(peerAuth, nil), geecache.WithSigner(peerAuth))
+	}
+	peers := geecache.NewHTTPPool(addr, opts...)
+	var leave func() // 下线时通知其他节点
+	peers.SetRebalanceGrace(grace)
+	if peersFile != "" {
+		// 节点列表和当前节点地址都来自配置文件
+		var err error
+		if peers, err = geecache.NewHTTPPoolFromFile(peersFile, opts...); err != nil {
+			log.Fatal(err)
+		}
+		addr = peers.Self()
+		peers.SetRebalanceGrace(grace)
+		peers.WatchPeerFile(peersFile, 0)
+	} else if gossip != "" {
+		// 节点列表由 gossip 动态维护
+		var seedList []string
+		if seeds != "" {
+			seedList = strings.Split(seeds, ",")
+		}
+		members := startMembership(addr, gossip, seedList, peers)
+		leave = func() { members.Leave() }
+	} else if dnsName != "" {
+		// 节点列表由 DNS 记录维护
+		startDNSDiscovery(dnsName, dnsSRV, port, scheme, peers)
+	} else {
+		peers.Set(addrs...) // 设置其他节点的地址
 	}
 
 	// 启动缓存服务器
-	startCacheServer(addrMap[port], addrs, gee)
+	startCacheServer(addr, peers, gee, handoff, leave, certs)
 }